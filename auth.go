@@ -0,0 +1,240 @@
+package comfyui2go
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	resty "resty.dev/v3"
+)
+
+// Authenticator 为 HTTP 请求和 WebSocket 握手添加认证信息，实现需并发安全。
+type Authenticator interface {
+	// Apply 将认证信息写入请求头
+	Apply(ctx context.Context, header http.Header) error
+}
+
+// RefreshableAuthenticator 是可以失效重取的认证方式。
+// 服务器返回 401 时会调用 Invalidate，下一次 Apply 重新获取凭据。
+type RefreshableAuthenticator interface {
+	Authenticator
+	Invalidate()
+}
+
+// WithAuthenticator 设置认证方式，同时作用于 HTTP 请求和 WebSocket 连接。
+func WithAuthenticator(auth Authenticator) Option {
+	return func(c *Client) { c.auth = auth }
+}
+
+// installAuth 在 HTTP 请求链上挂载认证，并在收到 401 时让可刷新的凭据失效
+func (c *Client) installAuth() {
+	auth := c.auth
+	c.cli.AddRequestMiddleware(func(_ *resty.Client, r *resty.Request) error {
+		return auth.Apply(r.Context(), r.Header)
+	})
+	c.cli.AddResponseMiddleware(func(_ *resty.Client, r *resty.Response) error {
+		if r.StatusCode() == http.StatusUnauthorized {
+			invalidateAuth(auth)
+		}
+		return nil
+	})
+}
+
+func invalidateAuth(auth Authenticator) {
+	if ra, ok := auth.(RefreshableAuthenticator); ok {
+		ra.Invalidate()
+	}
+}
+
+// AuthFunc 将普通函数适配为 Authenticator
+type AuthFunc func(ctx context.Context, header http.Header) error
+
+// Apply 实现 Authenticator
+func (f AuthFunc) Apply(ctx context.Context, header http.Header) error { return f(ctx, header) }
+
+// BasicAuth 返回 HTTP 基本认证
+func BasicAuth(username, password string) Authenticator {
+	value := "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	return AuthFunc(func(_ context.Context, h http.Header) error {
+		h.Set("Authorization", value)
+		return nil
+	})
+}
+
+// BearerToken 返回固定的 Bearer 令牌认证
+func BearerToken(token string) Authenticator {
+	return AuthFunc(func(_ context.Context, h http.Header) error {
+		h.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// StaticHeaders 返回固定请求头认证（如 API 网关要求的 X-API-Key）
+func StaticHeaders(headers map[string]string) Authenticator {
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
+	}
+	return AuthFunc(func(_ context.Context, h http.Header) error {
+		for k, v := range copied {
+			h.Set(k, v)
+		}
+		return nil
+	})
+}
+
+// TokenFetcher 获取新的访问令牌及其过期时间（零值表示不过期）
+type TokenFetcher func(ctx context.Context) (token string, expiry time.Time, err error)
+
+// TokenAuth 是带过期时间的 Bearer 令牌认证：令牌即将过期（默认提前 30 秒）或被 Invalidate 后重新获取。
+type TokenAuth struct {
+	fetch TokenFetcher
+	skew  time.Duration
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// RefreshableToken 创建可刷新的令牌认证，默认提前 30 秒刷新。
+func RefreshableToken(fetch TokenFetcher) *TokenAuth {
+	return &TokenAuth{fetch: fetch, skew: 30 * time.Second}
+}
+
+// WithSkew 设置提前刷新的时间
+func (t *TokenAuth) WithSkew(d time.Duration) *TokenAuth {
+	t.mu.Lock()
+	t.skew = d
+	t.mu.Unlock()
+	return t
+}
+
+// Apply 实现 Authenticator
+func (t *TokenAuth) Apply(ctx context.Context, h http.Header) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.token == "" || (!t.expiry.IsZero() && time.Now().Add(t.skew).After(t.expiry)) {
+		token, expiry, err := t.fetch(ctx)
+		if err != nil {
+			return fmt.Errorf("refresh token: %w", err)
+		}
+		t.token, t.expiry = token, expiry
+	}
+	h.Set("Authorization", "Bearer "+t.token)
+	return nil
+}
+
+// Invalidate 实现 RefreshableAuthenticator
+func (t *TokenAuth) Invalidate() {
+	t.mu.Lock()
+	t.token = ""
+	t.mu.Unlock()
+}
+
+// CookieLoginAuth 通过登录接口获取会话 Cookie（ComfyUI 登录插件常用的方式），
+// 之后的请求都携带该 Cookie；会话失效（401）后自动重新登录。
+type CookieLoginAuth struct {
+	loginURL string
+	body     func() (contentType string, body string, err error)
+	client   *http.Client
+
+	mu      sync.Mutex
+	cookies []*http.Cookie
+}
+
+// CookieLogin 创建以表单提交登录的 Cookie 认证，loginURL 为完整地址（如 "https://host/login"）。
+func CookieLogin(loginURL string, form url.Values) *CookieLoginAuth {
+	encoded := form.Encode()
+	return newCookieLogin(loginURL, func() (string, string, error) {
+		return "application/x-www-form-urlencoded", encoded, nil
+	})
+}
+
+// CookieLoginJSON 创建以 JSON 请求体登录的 Cookie 认证。
+func CookieLoginJSON(loginURL string, payload interface{}) *CookieLoginAuth {
+	return newCookieLogin(loginURL, func() (string, string, error) {
+		data, err := json.Marshal(payload)
+		return "application/json", string(data), err
+	})
+}
+
+func newCookieLogin(loginURL string, body func() (string, string, error)) *CookieLoginAuth {
+	return &CookieLoginAuth{
+		loginURL: loginURL,
+		body:     body,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			// 登录成功通常以重定向响应下发 Cookie，不跟随重定向以便读取
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+// WithHTTPClient 设置登录请求使用的 http.Client（如需代理或自定义 TLS）；会保留不跟随重定向的行为。
+func (a *CookieLoginAuth) WithHTTPClient(hc *http.Client) *CookieLoginAuth {
+	copied := *hc
+	copied.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	a.mu.Lock()
+	a.client = &copied
+	a.mu.Unlock()
+	return a
+}
+
+// Apply 实现 Authenticator
+func (a *CookieLoginAuth) Apply(ctx context.Context, h http.Header) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.cookies) == 0 {
+		if err := a.loginLocked(ctx); err != nil {
+			return err
+		}
+	}
+	parts := make([]string, 0, len(a.cookies))
+	for _, ck := range a.cookies {
+		parts = append(parts, ck.Name+"="+ck.Value)
+	}
+	if existing := h.Get("Cookie"); existing != "" {
+		parts = append([]string{existing}, parts...)
+	}
+	h.Set("Cookie", strings.Join(parts, "; "))
+	return nil
+}
+
+func (a *CookieLoginAuth) loginLocked(ctx context.Context) error {
+	contentType, body, err := a.body()
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.loginURL, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("login: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("login failed: %s", resp.Status)
+	}
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return fmt.Errorf("login failed: no session cookie in response")
+	}
+	a.cookies = cookies
+	return nil
+}
+
+// Invalidate 实现 RefreshableAuthenticator
+func (a *CookieLoginAuth) Invalidate() {
+	a.mu.Lock()
+	a.cookies = nil
+	a.mu.Unlock()
+}
@@ -0,0 +1,194 @@
+package comfyui2go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrBatchAborted 表示批量任务被中止：因 fail-fast 未提交或已被取消，或因 ctx 结束未提交
+var ErrBatchAborted = errors.New("batch aborted")
+
+// BatchOption 用于自定义 Batch
+type BatchOption func(*batchOptions)
+
+type batchOptions struct {
+	concurrency int
+	failFast    bool
+	progress    BatchProgressFunc
+	wait        []WaitOption
+}
+
+// WithBatchConcurrency 设置同时提交并等待的最大任务数（默认 4）
+func WithBatchConcurrency(n int) BatchOption {
+	return func(o *batchOptions) {
+		if n > 0 {
+			o.concurrency = n
+		}
+	}
+}
+
+// WithFailFast 任一任务失败时中止批量：不再提交剩余任务，并取消已提交但未结束的任务。
+// 默认继续执行其余任务。
+func WithFailFast() BatchOption {
+	return func(o *batchOptions) { o.failFast = true }
+}
+
+// WithBatchProgress 设置进度回调，任务提交或结束时调用
+func WithBatchProgress(fn BatchProgressFunc) BatchOption {
+	return func(o *batchOptions) { o.progress = fn }
+}
+
+// WithBatchWaitOptions 设置等待每个任务结束时使用的选项
+func WithBatchWaitOptions(opts ...WaitOption) BatchOption {
+	return func(o *batchOptions) { o.wait = append(o.wait, opts...) }
+}
+
+// BatchResult 为批量中单个工作流的结果
+type BatchResult struct {
+	// Index 为工作流在输入中的下标
+	Index    int
+	PromptID string
+	// Result 在任务结束时非空；执行失败时可能包含部分输出
+	Result *WaitResult
+	Err    error
+}
+
+// BatchProgress 为批量的汇总进度
+type BatchProgress struct {
+	Total     int
+	Submitted int
+	Succeeded int
+	Failed    int
+	Aborted   int
+}
+
+// Finished 返回已结束（成功、失败或中止）的任务数
+func (p BatchProgress) Finished() int {
+	return p.Succeeded + p.Failed + p.Aborted
+}
+
+// BatchProgressFunc 接收汇总进度和刚发生变化的任务结果。
+// 回调是串行调用的，不应长时间阻塞。
+type BatchProgressFunc func(p BatchProgress, item BatchResult)
+
+// Batch 以有限并发提交多个工作流并等待全部结束，按输入顺序返回每个工作流的结果。
+//
+// 返回的错误合并了各失败任务的错误（可用 errors.Is / errors.As 检查），全部成功时为 nil；
+// 无论是否出错，结果切片的长度总与 workflows 相同。
+// ctx 结束后不再提交新任务，正在等待的任务以 ctx 的错误结束，但服务器上的任务不受影响；
+// 未提交的任务计为中止，其错误同时匹配 ErrBatchAborted 和 ctx 的错误，返回的错误也包含 ctx 的错误。
+func (c *Client) Batch(ctx context.Context, workflows []JSON, opts ...BatchOption) ([]BatchResult, error) {
+	o := batchOptions{concurrency: 4}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	results := make([]BatchResult, len(workflows))
+	attempted := make([]bool, len(workflows))
+	for i := range results {
+		results[i].Index = i
+	}
+
+	var (
+		mu        sync.Mutex
+		progress  = BatchProgress{Total: len(workflows)}
+		aborted   = make(chan struct{})
+		abortOnce sync.Once
+	)
+	abort := func() { abortOnce.Do(func() { close(aborted) }) }
+	// update 在锁内修改结果与进度并串行调用回调
+	update := func(i int, fn func(r *BatchResult, p *BatchProgress)) {
+		mu.Lock()
+		defer mu.Unlock()
+		fn(&results[i], &progress)
+		if o.progress != nil {
+			o.progress(progress, results[i])
+		}
+	}
+	finish := func(i int, result *WaitResult, err error) {
+		update(i, func(r *BatchResult, p *BatchProgress) {
+			r.Result, r.Err = result, err
+			switch {
+			case err == nil:
+				p.Succeeded++
+			case errors.Is(err, ErrBatchAborted):
+				p.Aborted++
+			default:
+				p.Failed++
+			}
+		})
+		if err != nil && o.failFast && !errors.Is(err, ErrBatchAborted) {
+			abort()
+		}
+	}
+
+	sem := make(chan struct{}, o.concurrency)
+	var (
+		wg     sync.WaitGroup
+		ctxErr error // ctx 结束导致剩余任务未提交时的错误
+	)
+	for i, workflow := range workflows {
+		var stopped error
+		select {
+		case sem <- struct{}{}:
+		case <-aborted:
+		case <-ctx.Done():
+		}
+		select {
+		case <-aborted:
+			stopped = ErrBatchAborted
+		default:
+			if ctxErr = ctx.Err(); ctxErr != nil {
+				stopped = fmt.Errorf("%w: %w", ErrBatchAborted, ctxErr)
+			}
+		}
+		if stopped != nil {
+			for j := i; j < len(workflows); j++ {
+				finish(j, nil, stopped)
+			}
+			break
+		}
+
+		attempted[i] = true
+		wg.Add(1)
+		go func(i int, workflow JSON) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			run, err := c.Run(ctx, workflow, WithRunWaitOptions(o.wait...))
+			if err != nil {
+				finish(i, nil, err)
+				return
+			}
+			update(i, func(r *BatchResult, p *BatchProgress) {
+				r.PromptID = run.PromptID()
+				p.Submitted++
+			})
+			select {
+			case <-run.Done():
+			case <-aborted:
+				// 中止时取消已提交的任务；取消失败则继续等待其自然结束
+				_ = run.Cancel(context.WithoutCancel(ctx))
+			}
+			result, err := run.Wait(context.Background())
+			if errors.Is(err, ErrRunCancelled) {
+				err = ErrBatchAborted
+			}
+			finish(i, result, err)
+		}(i, workflow)
+	}
+	wg.Wait()
+
+	var errs []error
+	for i, r := range results {
+		if r.Err != nil && attempted[i] && !errors.Is(r.Err, ErrBatchAborted) {
+			errs = append(errs, fmt.Errorf("batch item %d: %w", i, r.Err))
+		}
+	}
+	if ctxErr != nil {
+		errs = append(errs, ctxErr)
+	}
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,267 @@
+package comfyui2go
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WorkflowHash 计算工作流图的规范哈希（SHA-256 十六进制）。
+// 对象键按字典序排列，并忽略节点上仅用于界面展示的 "_meta" 字段，
+// 因此仅键顺序或节点标题不同的工作流得到相同的哈希。
+func WorkflowHash(workflow JSON) (string, error) {
+	canonical := make(JSON, len(workflow))
+	for id, v := range workflow {
+		node, ok := v.(map[string]interface{})
+		if !ok {
+			canonical[id] = v
+			continue
+		}
+		stripped := make(map[string]interface{}, len(node))
+		for k, fv := range node {
+			if k == "_meta" {
+				continue
+			}
+			stripped[k] = fv
+		}
+		canonical[id] = stripped
+	}
+
+	// encoding/json 对 map 的键总是按字典序输出
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// CachedAsset 是缓存中的一个已下载输出文件。
+type CachedAsset struct {
+	OutputAsset
+	Data []byte `json:"data"`
+}
+
+// CachedResult 是一次工作流执行的缓存结果。
+type CachedResult struct {
+	Key      string        `json:"key"`
+	Result   *WaitResult   `json:"result"`
+	Assets   []CachedAsset `json:"assets,omitempty"`
+	StoredAt time.Time     `json:"stored_at"`
+}
+
+// ResultCache 是结果缓存的存储接口，实现需并发安全。
+type ResultCache interface {
+	// Get 返回未过期的缓存结果；不存在或已过期时返回 (nil, false, nil)
+	Get(ctx context.Context, key string) (*CachedResult, bool, error)
+	// Set 写入缓存结果
+	Set(ctx context.Context, key string, res *CachedResult) error
+}
+
+// WithResultCache 为客户端设置结果缓存，供 PromptCached 使用。
+func WithResultCache(cache ResultCache) Option {
+	return func(c *Client) { c.resultCache = cache }
+}
+
+// PromptCached 按工作流的规范哈希查找缓存：命中时直接返回之前的结果和已下载的文件（hit 为 true），
+// 否则提交工作流、等待完成、下载全部输出文件并写入缓存。未设置缓存时等同于不缓存地执行一次。
+// 等待没有额外的超时，由 ctx 控制。
+func (c *Client) PromptCached(ctx context.Context, workflow JSON) (res *CachedResult, hit bool, err error) {
+	key, err := WorkflowHash(workflow)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if c.resultCache != nil {
+		cached, ok, err := c.resultCache.Get(ctx, key)
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			return cached, true, nil
+		}
+	}
+
+	promptID, err := c.Prompt(ctx, workflow)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// 等待时长由 ctx 决定；WebSocket 不可用时 Wait 自动改为轮询
+	result, err := c.Wait(ctx, promptID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	res = &CachedResult{Key: key, Result: result, StoredAt: time.Now()}
+	for _, asset := range result.Item.Assets() {
+		data, err := c.Download(ctx, asset.Filename, asset.Subfolder, asset.Type)
+		if err != nil {
+			return nil, false, fmt.Errorf("download %s: %w", asset.Filename, err)
+		}
+		res.Assets = append(res.Assets, CachedAsset{OutputAsset: asset, Data: data})
+	}
+
+	if c.resultCache != nil {
+		if err := c.resultCache.Set(ctx, key, res); err != nil {
+			return res, false, err
+		}
+	}
+	return res, false, nil
+}
+
+// MemoryResultCache 是带 TTL 的内存 LRU 结果缓存。
+type MemoryResultCache struct {
+	maxEntries int
+	ttl        time.Duration
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+// NewMemoryResultCache 创建内存 LRU 缓存；maxEntries<=0 表示不限数量，ttl<=0 表示永不过期。
+func NewMemoryResultCache(maxEntries int, ttl time.Duration) *MemoryResultCache {
+	return &MemoryResultCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get 实现 ResultCache
+func (m *MemoryResultCache) Get(_ context.Context, key string) (*CachedResult, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	el, ok := m.items[key]
+	if !ok {
+		return nil, false, nil
+	}
+	res := el.Value.(*CachedResult)
+	if expired(res, m.ttl) {
+		m.ll.Remove(el)
+		delete(m.items, key)
+		return nil, false, nil
+	}
+	m.ll.MoveToFront(el)
+	return res, true, nil
+}
+
+// Set 实现 ResultCache
+func (m *MemoryResultCache) Set(_ context.Context, key string, res *CachedResult) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if el, ok := m.items[key]; ok {
+		el.Value = res
+		m.ll.MoveToFront(el)
+		return nil
+	}
+	m.items[key] = m.ll.PushFront(res)
+	for m.maxEntries > 0 && m.ll.Len() > m.maxEntries {
+		oldest := m.ll.Back()
+		m.ll.Remove(oldest)
+		delete(m.items, oldest.Value.(*CachedResult).Key)
+	}
+	return nil
+}
+
+// Len 返回缓存条目数量
+func (m *MemoryResultCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ll.Len()
+}
+
+// FileResultCache 是基于文件系统的结果缓存，每个键对应目录下的一个 JSON 文件。
+type FileResultCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// NewFileResultCache 创建文件系统缓存；ttl<=0 表示永不过期。
+func NewFileResultCache(dir string, ttl time.Duration) (*FileResultCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileResultCache{dir: dir, ttl: ttl}, nil
+}
+
+func (f *FileResultCache) path(key string) string {
+	return filepath.Join(f.dir, key+".json")
+}
+
+// Get 实现 ResultCache
+func (f *FileResultCache) Get(_ context.Context, key string) (*CachedResult, bool, error) {
+	data, err := os.ReadFile(f.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	var res CachedResult
+	if err := json.Unmarshal(data, &res); err != nil {
+		// 损坏的缓存文件视为未命中
+		os.Remove(f.path(key))
+		return nil, false, nil
+	}
+	if expired(&res, f.ttl) {
+		os.Remove(f.path(key))
+		return nil, false, nil
+	}
+	return &res, true, nil
+}
+
+// Set 实现 ResultCache，先写临时文件再重命名，避免读到写了一半的文件
+func (f *FileResultCache) Set(_ context.Context, key string, res *CachedResult) error {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(f.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(key))
+}
+
+// Prune 删除目录中所有已过期的缓存文件
+func (f *FileResultCache) Prune(ctx context.Context) error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || filepath.Ext(name) != ".json" {
+			continue
+		}
+		if _, _, err := f.Get(ctx, name[:len(name)-len(".json")]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expired(res *CachedResult, ttl time.Duration) bool {
+	return ttl > 0 && time.Since(res.StoredAt) > ttl
+}
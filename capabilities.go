@@ -0,0 +1,272 @@
+package comfyui2go
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	resty "resty.dev/v3"
+)
+
+// 各特性首次出现的 ComfyUI 版本；更早的版本（包括不报告版本号的服务器）使用兼容的请求与消息格式
+const (
+	versionProgressPromptID  = "0.2.0"  // progress 消息携带 prompt_id 和 node
+	versionProgressState     = "0.3.43" // 发送 progress_state 消息
+	versionTargetedInterrupt = "0.3.45" // /interrupt 接受 prompt_id，只中断指定任务
+)
+
+// probeRetryInterval 探测失败后，在此间隔内不再自动重试
+const probeRetryInterval = time.Minute
+
+// ServerCapabilities 记录探测到的服务器版本与特性，不同版本的 ComfyUI 消息格式和接口有所差异。
+type ServerCapabilities struct {
+	// Version 为 ComfyUI 版本（来自 /system_stats），旧版本服务器为空
+	Version string `json:"version,omitempty"`
+	// Features 为 GET /features 的原始内容，旧版本服务器为空
+	Features JSON `json:"features,omitempty"`
+	// APIPrefix 表示服务器同时提供 /api/* 形式的路由
+	APIPrefix bool `json:"api_prefix"`
+	// SupportsPreviewMetadata 表示预览图 WebSocket 消息可携带元数据（prompt_id、node_id 等）
+	SupportsPreviewMetadata bool `json:"supports_preview_metadata"`
+	// MaxUploadSize 为服务器允许的最大上传字节数，0 表示未知
+	MaxUploadSize int64 `json:"max_upload_size,omitempty"`
+	// ProgressPromptID 表示 progress 消息携带 prompt_id
+	ProgressPromptID bool `json:"progress_prompt_id"`
+	// ProgressState 表示服务器发送 progress_state 消息（逐节点进度）
+	ProgressState bool `json:"progress_state"`
+	// TargetedInterrupt 表示 /interrupt 支持 prompt_id
+	TargetedInterrupt bool `json:"targeted_interrupt"`
+	// ProbedAt 为探测时间
+	ProbedAt time.Time `json:"probed_at"`
+}
+
+// AtLeast 判断服务器版本是否不低于 version（如 "0.3.30"），版本未知时返回 false。
+func (s *ServerCapabilities) AtLeast(version string) bool {
+	if s == nil || s.Version == "" {
+		return false
+	}
+	have, want := parseVersion(s.Version), parseVersion(version)
+	for i := range want {
+		if have[i] != want[i] {
+			return have[i] > want[i]
+		}
+	}
+	return true
+}
+
+// parseVersion 解析 "主.次.修订" 形式的版本号，忽略前缀 v 和后缀（如 "-rc1"）
+func parseVersion(v string) [3]int {
+	var out [3]int
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	for i, part := range strings.SplitN(v, ".", 3) {
+		end := 0
+		for end < len(part) && part[end] >= '0' && part[end] <= '9' {
+			end++
+		}
+		out[i], _ = strconv.Atoi(part[:end])
+	}
+	return out
+}
+
+// Probe 探测服务器能力（/features、/system_stats 以及 /api 前缀路由）并记录在客户端上。
+// 单个接口不存在视为旧版本服务器而不是错误；只有服务器完全不可用时才返回错误。
+//
+// 通常无需手动调用：建立 WebSocket 连接或调用 InterruptPrompt 时会自动探测一次。
+// 探测结果决定请求形式：服务器提供 /api 路由且未通过 WithAPIPrefix 显式配置时，HTTP 与 WebSocket 改用 /api 命名空间；
+// 进度消息按版本解析（见 ServerCapabilities）；InterruptPrompt 只在支持的服务器上发送 prompt_id。
+func (c *Client) Probe(ctx context.Context) (*ServerCapabilities, error) {
+	caps := &ServerCapabilities{ProbedAt: time.Now()}
+
+	// 使用绝对地址，不受 WithAPIPrefix 影响；优先请求 /api/system_stats，成功即说明支持 /api 前缀
+	var stats SystemStats
+	r, err := c.cli.R().SetContext(ctx).SetResult(&stats).Get(c.rootURL() + "/api/system_stats")
+	if err != nil {
+		return nil, err
+	}
+	if r.IsSuccess() {
+		caps.APIPrefix = true
+	} else {
+		r, err = c.cli.R().SetContext(ctx).SetResult(&stats).Get(c.rootURL() + "/system_stats")
+		if err != nil {
+			return nil, err
+		}
+		if !r.IsSuccess() {
+			return nil, fmt.Errorf("/system_stats failed: %s", r.String())
+		}
+	}
+	caps.Version = stats.System.ComfyUIVersion
+	caps.ProgressPromptID = caps.AtLeast(versionProgressPromptID)
+	caps.ProgressState = caps.AtLeast(versionProgressState)
+	caps.TargetedInterrupt = caps.AtLeast(versionTargetedInterrupt)
+
+	featuresURL := c.rootURL() + "/features"
+	if caps.APIPrefix {
+		featuresURL = c.rootURL() + "/api/features"
+	}
+	var features JSON
+	r, err = c.cli.R().SetContext(ctx).SetResult(&features).Get(featuresURL)
+	if err != nil {
+		return nil, err
+	}
+	if r.IsSuccess() && features != nil {
+		caps.Features = features
+		caps.SupportsPreviewMetadata, _ = features["supports_preview_metadata"].(bool)
+		if n, ok := features["max_upload_size"].(float64); ok {
+			caps.MaxUploadSize = int64(n)
+		}
+	}
+
+	c.capsMu.Lock()
+	c.caps = caps
+	c.capsMu.Unlock()
+	return caps, nil
+}
+
+// installAPINegotiation 在请求链上按探测结果把相对路径的请求改发到 /api 命名空间。
+// 不修改 Resty 客户端的基础地址：该客户端可能由调用方通过 WithHTTP 提供，也可能正被其他请求并发使用。
+// 重试时 URL 已是绝对地址，不会重复添加前缀。
+func (c *Client) installAPINegotiation() {
+	if c.apiPrefixSet {
+		return
+	}
+	c.cli.AddRequestMiddleware(func(_ *resty.Client, r *resty.Request) error {
+		if strings.HasPrefix(r.URL, "/") && c.useAPIPrefix() {
+			r.URL = c.apiURL() + r.URL
+		}
+		return nil
+	})
+}
+
+// cachedCapabilities 返回已记录的服务器能力，尚未探测时为 nil
+func (c *Client) cachedCapabilities() *ServerCapabilities {
+	c.capsMu.RLock()
+	defer c.capsMu.RUnlock()
+	return c.caps
+}
+
+// ensureCapabilities 在尚未探测时探测一次服务器能力。探测失败不影响调用方：返回 nil，
+// 按旧版本服务器处理，并在 probeRetryInterval 内不再重试。
+func (c *Client) ensureCapabilities(ctx context.Context) *ServerCapabilities {
+	if caps := c.cachedCapabilities(); caps != nil {
+		return caps
+	}
+	c.probeMu.Lock()
+	defer c.probeMu.Unlock()
+	if caps := c.cachedCapabilities(); caps != nil {
+		return caps
+	}
+	if !c.probeFailed.IsZero() && time.Since(c.probeFailed) < probeRetryInterval {
+		return nil
+	}
+	caps, err := c.Probe(ctx)
+	if err != nil {
+		c.probeFailed = time.Now()
+		c.log().Debug("comfyui capability probe failed", "error", err)
+		return nil
+	}
+	return caps
+}
+
+// Capabilities 返回已记录的服务器能力，尚未探测时先执行一次 Probe。
+func (c *Client) Capabilities(ctx context.Context) (*ServerCapabilities, error) {
+	if caps := c.cachedCapabilities(); caps != nil {
+		return caps, nil
+	}
+	return c.Probe(ctx)
+}
+
+// InterruptPrompt 只中断指定的 prompt：正在执行时发送 /interrupt，仍在排队时从队列中删除，已结束时什么也不做。
+// 支持定向中断的服务器会收到 prompt_id 并再次核对；旧版本服务器收到不带参数的 /interrupt，
+// 中断的是刚刚确认正在执行的该任务。与 Interrupt 不同，它不会误中断其他任务。
+func (c *Client) InterruptPrompt(ctx context.Context, promptID string) error {
+	caps := c.ensureCapabilities(ctx)
+	queue, err := c.GetQueue(ctx)
+	if err != nil {
+		return err
+	}
+	switch {
+	case queueContains(queue.QueueRunning, promptID):
+		req := c.cli.R().SetContext(ctx)
+		if caps != nil && caps.TargetedInterrupt {
+			req.SetHeader("Content-Type", "application/json").SetBody(JSON{"prompt_id": promptID})
+		}
+		r, err := req.Post("/interrupt")
+		if err != nil {
+			return err
+		}
+		if !r.IsSuccess() {
+			return fmt.Errorf("/interrupt failed: %s", r.String())
+		}
+	case queueContains(queue.QueuePending, promptID):
+		return c.DeleteFromQueue(ctx, promptID)
+	}
+	return nil
+}
+
+// progressUpdates 按服务器能力解析进度消息。发送 progress_state 的服务器以其为准并忽略 progress，避免重复；
+// 其余服务器使用 progress。旧版本服务器的 progress 不带 prompt_id，此时返回的 PromptID 为空。
+func progressUpdates(caps *ServerCapabilities, msg WSMessage) []WSProgressMessage {
+	switch msg.Type {
+	case "progress":
+		if caps != nil && caps.ProgressState {
+			return nil
+		}
+		p := WSProgressMessage{}
+		p.PromptID, _ = msg.Data["prompt_id"].(string)
+		p.Node, _ = msg.Data["node"].(string)
+		if v, ok := msg.Data["value"].(float64); ok {
+			p.Value = int(v)
+		}
+		if m, ok := msg.Data["max"].(float64); ok {
+			p.Max = int(m)
+		}
+		return []WSProgressMessage{p}
+	case "progress_state":
+		if caps == nil || !caps.ProgressState {
+			return nil
+		}
+		promptID, _ := msg.Data["prompt_id"].(string)
+		nodes, _ := msg.Data["nodes"].(map[string]interface{})
+		var updates []WSProgressMessage
+		for id, raw := range nodes {
+			n, _ := raw.(map[string]interface{})
+			if state, _ := n["state"].(string); state != "running" {
+				continue
+			}
+			p := WSProgressMessage{PromptID: promptID, Node: id}
+			if display, _ := n["display_node_id"].(string); display != "" {
+				p.Node = display
+			}
+			if v, ok := n["value"].(float64); ok {
+				p.Value = int(v)
+			}
+			if m, ok := n["max"].(float64); ok {
+				p.Max = int(m)
+			}
+			updates = append(updates, p)
+		}
+		sort.Slice(updates, func(i, j int) bool { return updates[i].Node < updates[j].Node })
+		return updates
+	}
+	return nil
+}
+
+// progressFor 返回属于 promptID 的进度更新。running 表示该任务正在执行：
+// 服务器版本未知或过旧时，不带 prompt_id 的进度归属于正在执行的任务。
+func progressFor(caps *ServerCapabilities, msg WSMessage, promptID string, running bool) []WSProgressMessage {
+	var out []WSProgressMessage
+	for _, p := range progressUpdates(caps, msg) {
+		switch {
+		case p.PromptID == promptID:
+		case p.PromptID == "" && running && (caps == nil || !caps.ProgressPromptID):
+			p.PromptID = promptID
+		default:
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
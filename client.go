@@ -2,8 +2,10 @@ package comfyui2go
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"sync"
 	"time"
 
@@ -14,23 +16,75 @@ type Client struct {
 	cli      *resty.Client
 	clientID string
 	baseURL  string
-	username string
-	password string
 
 	// WebSocket连接管理
 	wsClient  *WSClient
 	wsMu      sync.RWMutex
 	wsEnabled bool // WebSocket是否启用
 
+	// 反向代理路径前缀与 /api 命名空间
+	pathPrefix   string
+	apiPrefix    bool
+	apiPrefixSet bool // 是否通过 WithAPIPrefix 显式配置，未配置时按探测结果选择
+
+	// 认证方式，同时用于 HTTP 和 WebSocket
+	auth Authenticator
+
+	// TLS 与代理配置，同时用于 HTTP 和 WebSocket
+	transport transportOptions
+
+	// 结构化日志（可选）
+	logger *slog.Logger
+
+	// 指标与追踪（可选），以及执行中 prompt 的跟踪记录
+	metrics  Metrics
+	tracer   Tracer
+	tracksMu sync.Mutex
+	tracks   map[string]*promptTrack
+
 	// WebSocket回调函数
 	onProgress  ProgressCallback
 	onStatus    StatusCallback
 	onExecution ExecutionCallback
 	onError     ErrorCallback
+
+	// 结果缓存（可选）
+	resultCache ResultCache
+
+	// 内容寻址上传：文件名 -> 上传结果
+	uploadDedup bool
+	uploadMu    sync.Mutex
+	uploadIndex map[string]UploadResponse
+
+	// 内部消息监听器，WebSocket重连后依然有效
+	listenersMu sync.RWMutex
+	listeners   map[int]func(WSMessage)
+	nextListen  int
+
+	// 自动释放策略（可选）与上一次提交的模型族
+	autoFree   *AutoFreePolicy
+	freeMu     sync.Mutex
+	lastFamily string
+
+	// 实时日志订阅计数
+	logsMu  sync.Mutex
+	logSubs int
+
+	// 探测到的服务器能力
+	capsMu      sync.RWMutex
+	caps        *ServerCapabilities
+	probeMu     sync.Mutex
+	probeFailed time.Time
 }
 
 // NewClient 创建客户端的简单方式，只需要基本参数（默认启用WebSocket）
 func NewClient(clientID, baseURL string) *Client {
+	c := newClient(clientID, baseURL)
+	c.installAPINegotiation()
+	return c
+}
+
+func newClient(clientID, baseURL string) *Client {
 	r := resty.New()
 	c := &Client{
 		cli:       r,
@@ -44,22 +98,62 @@ func NewClient(clientID, baseURL string) *Client {
 
 // NewClientWithOptions 创建客户端的完整方式，支持所有配置选项
 func NewClientWithOptions(clientID, baseURL string, opts ...Option) *Client {
-	c := NewClient(clientID, baseURL)
+	c := newClient(clientID, baseURL)
 	for _, o := range opts {
 		o(c)
 	}
+	if c.pathPrefix != "" || c.apiPrefix {
+		c.cli.SetBaseURL(c.apiURL())
+	}
+	c.installAPINegotiation()
+	c.applyTransport()
+	if c.auth != nil {
+		c.installAuth()
+	}
+	if c.logger != nil {
+		c.installLogging()
+	}
+	if c.tracer != nil {
+		c.installTracing()
+	}
+	if c.tracksPrompts() {
+		c.addWSListener(c.observeWSMessage)
+	}
 	return c
 }
 
 // Prompt 调用 POST /prompt 提交工作流（图形 JSON）。
 // 返回可用于后续查询历史记录的 prompt_id。
 func (c *Client) Prompt(ctx context.Context, prompt JSON) (string, error) {
+	ctx, span := c.tracing().Start(ctx, "comfyui.prompt", Attr("comfyui.prompt.nodes", len(prompt)))
+	resp, submitted, err := c.submitPrompt(ctx, prompt)
+	if err != nil {
+		span.End(err)
+		return "", err
+	}
+	span.SetAttributes(Attr("comfyui.prompt_id", resp.PromptID))
+	span.AddEvent("queued", Attr("comfyui.prompt.number", resp.Number))
+	c.trackPrompt(ctx, span, resp.PromptID, prompt, submitted)
+	return resp.PromptID, nil
+}
+
+// submitPrompt 提交工作流，返回服务器响应与提交时间
+func (c *Client) submitPrompt(ctx context.Context, prompt JSON) (PromptResponse, time.Time, error) {
+	var resp PromptResponse
+	if err := c.applyAutoFree(ctx, prompt); err != nil {
+		return resp, time.Time{}, err
+	}
+	if c.tracksPrompts() && c.wsEnabled {
+		// 先建立 WebSocket 连接，避免错过 execution_start 等计时事件
+		_ = c.ensureWebSocketConnected(ctx)
+	}
+	submitted := time.Now()
+
 	body := JSON{
 		"prompt":    prompt,
 		"client_id": c.clientID,
 	}
 
-	var resp PromptResponse
 	r, err := c.cli.R().
 		SetContext(ctx).
 		SetHeader("Content-Type", "application/json").
@@ -67,18 +161,21 @@ func (c *Client) Prompt(ctx context.Context, prompt JSON) (string, error) {
 		SetResult(&resp).
 		Post("/prompt")
 	if err != nil {
-		return "", err
+		return resp, submitted, err
 	}
 	if !r.IsSuccess() {
-		return "", fmt.Errorf("/prompt failed: %s", r.String())
+		return resp, submitted, fmt.Errorf("/prompt failed: %s", r.String())
 	}
 	if resp.Error.Type != "" {
-		return "", fmt.Errorf("prompt failed: type=%s, message=%s, details=%s, extra_info=%v", resp.Error.Type, resp.Error.Message, resp.Error.Details, resp.Error.ExtraInfo)
+		c.log().Warn("comfyui prompt rejected", "type", resp.Error.Type, "message", resp.Error.Message)
+		return resp, submitted, fmt.Errorf("prompt failed: type=%s, message=%s, details=%s, extra_info=%v", resp.Error.Type, resp.Error.Message, resp.Error.Details, resp.Error.ExtraInfo)
 	}
 	if len(resp.NodeErrors) > 0 {
-		return "", fmt.Errorf("prompt failed: node_errors=%v", resp.NodeErrors)
+		c.log().Warn("comfyui prompt rejected", "node_errors", len(resp.NodeErrors))
+		return resp, submitted, fmt.Errorf("prompt failed: node_errors=%v", resp.NodeErrors)
 	}
-	return resp.PromptID, nil
+	c.log().Info("comfyui prompt submitted", "prompt_id", resp.PromptID, "number", resp.Number, "nodes", len(prompt))
+	return resp, submitted, nil
 }
 
 // GetQueue 获取 /queue 队列状态（运行中与等待中）。
@@ -91,6 +188,9 @@ func (c *Client) GetQueue(ctx context.Context) (QueueResponse, error) {
 	if !r.IsSuccess() {
 		return out, fmt.Errorf("/queue failed: %s", r.String())
 	}
+	if c.metrics != nil {
+		c.metrics.QueueDepth(c.getBaseURL(), len(out.QueueRunning), len(out.QueuePending))
+	}
 	return out, nil
 }
 
@@ -108,6 +208,36 @@ func (c *Client) GetHistory(ctx context.Context, promptID string) (HistoryRespon
 	return out, nil
 }
 
+// GetObjectInfo 调用 GET /object_info 返回服务器已注册的全部节点定义。
+// 键为节点 class_type，值为节点的输入/输出描述。
+func (c *Client) GetObjectInfo(ctx context.Context) (ObjectInfo, error) {
+	var out ObjectInfo
+	r, err := c.cli.R().SetContext(ctx).SetResult(&out).Get("/object_info")
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("/object_info failed: %s", r.String())
+	}
+	return out, nil
+}
+
+// DeleteFromQueue 调用 POST /queue 从等待队列中删除指定的 prompt（不影响正在执行的任务）。
+func (c *Client) DeleteFromQueue(ctx context.Context, promptIDs ...string) error {
+	r, err := c.cli.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(JSON{"delete": promptIDs}).
+		Post("/queue")
+	if err != nil {
+		return err
+	}
+	if !r.IsSuccess() {
+		return fmt.Errorf("/queue failed: %s", r.String())
+	}
+	return nil
+}
+
 // Interrupt 调用 /interrupt 以中断当前任务。
 func (c *Client) Interrupt(ctx context.Context) error {
 	r, err := c.cli.R().SetContext(ctx).Post("/interrupt")
@@ -122,6 +252,7 @@ func (c *Client) Interrupt(ctx context.Context) error {
 
 // WaitForCompletion 轮询 /history/{promptID}，直到完成或上下文取消。
 // pollEvery 为轮询间隔；若 <=0 则默认 1 秒。
+// 任务执行失败或被中断时同时返回结果（可能含部分输出）和 *ExecutionError（节点、异常与 traceback）。
 func (c *Client) WaitForCompletion(ctx context.Context, promptID string, pollEvery time.Duration) (*WaitResult, error) {
 	if pollEvery <= 0 {
 		pollEvery = time.Second
@@ -138,13 +269,13 @@ func (c *Client) WaitForCompletion(ctx context.Context, promptID string, pollEve
 			if err != nil {
 				return nil, err
 			}
-			if item, ok := h[promptID]; ok {
-				if item.Status != nil && item.Status.Completed {
-					return &WaitResult{PromptID: promptID, Item: item}, nil
-				}
-				if item.Outputs != nil {
-					return &WaitResult{PromptID: promptID, Item: item}, nil
+			if item, ok := h[promptID]; ok && item.Finished() {
+				c.observeHistory(promptID, item)
+				result := &WaitResult{PromptID: promptID, Item: item}
+				if failure := historyFailure(promptID, item); failure != nil {
+					return result, failure
 				}
+				return result, nil
 			}
 		}
 	}
@@ -152,21 +283,63 @@ func (c *Client) WaitForCompletion(ctx context.Context, promptID string, pollEve
 
 // UploadImage 上传图片文件到 ComfyUI 服务器。
 // 返回文件名和子文件夹等信息，可用于后续工作流中引用。
-func (c *Client) UploadImage(ctx context.Context, filename string, data io.Reader) (*UploadResponse, error) {
+// 可通过 WithSubfolder、WithUploadType、WithOverwrite 指定子文件夹、目标目录和是否覆盖同名文件，
+// 通过 WithPreprocess 在上传前校正方向、缩放或转换格式；
+// 启用 WithUploadDedup 时按内容寻址命名并跳过重复上传。
+func (c *Client) UploadImage(ctx context.Context, filename string, data io.Reader, opts ...UploadOption) (*UploadResponse, error) {
+	o, err := newUploadOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if filename, data, err = o.prepare(filename, data); err != nil {
+		return nil, err
+	}
+	if c.uploadDedup {
+		return c.uploadImageDedup(ctx, filename, data, o)
+	}
+	return c.upload(ctx, "/upload/image", filename, data, o.form())
+}
+
+// UploadMask 调用 POST /upload/mask 上传蒙版。服务器会把蒙版的 alpha 通道合并到 original 指向的图片上，
+// 用于驱动局部重绘（inpainting）工作流。original 通常是 UploadImage 的返回值。
+func (c *Client) UploadMask(ctx context.Context, filename string, data io.Reader, original UploadResponse, opts ...UploadOption) (*UploadResponse, error) {
+	o, err := newUploadOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if original.Name == "" {
+		return nil, fmt.Errorf("original image name is required")
+	}
+	if filename, data, err = o.prepare(filename, data); err != nil {
+		return nil, err
+	}
+	ref, err := json.Marshal(map[string]string{
+		"filename":  original.Name,
+		"subfolder": original.Subfolder,
+		"type":      original.Type,
+	})
+	if err != nil {
+		return nil, err
+	}
+	form := o.form()
+	form["original_ref"] = string(ref)
+	return c.upload(ctx, "/upload/mask", filename, data, form)
+}
+
+// upload 以 multipart 表单上传文件到 /upload/image 或 /upload/mask
+func (c *Client) upload(ctx context.Context, path, filename string, data io.Reader, form map[string]string) (*UploadResponse, error) {
 	var resp UploadResponse
 	r, err := c.cli.R().
 		SetContext(ctx).
 		SetFileReader("image", filename, data).
-		SetFormData(map[string]string{
-			"type": "input",
-		}).
+		SetFormData(form).
 		SetResult(&resp).
-		Post("/upload/image")
+		Post(path)
 	if err != nil {
 		return nil, err
 	}
 	if !r.IsSuccess() {
-		return nil, fmt.Errorf("/upload/image failed: %s", r.String())
+		return nil, fmt.Errorf("%s failed: %s", path, r.String())
 	}
 	return &resp, nil
 }
@@ -191,6 +364,9 @@ func (c *Client) Download(ctx context.Context, filename, subfolder, filetype str
 	if !r.IsSuccess() {
 		return nil, fmt.Errorf("download failed: %s", r.String())
 	}
+	if c.metrics != nil {
+		c.metrics.DownloadBytes(c.getBaseURL(), len(r.Bytes()))
+	}
 	return r.Bytes(), nil
 }
 
@@ -209,16 +385,30 @@ func (c *Client) ensureWebSocketConnected(ctx context.Context) error {
 		return nil
 	}
 
+	// 首次连接前探测服务器能力，决定 WebSocket 地址和消息格式
+	caps := c.ensureCapabilities(ctx)
+
+	if c.wsClient != nil {
+		c.log().Info("comfyui websocket reconnecting", "client_id", c.clientID)
+		if c.metrics != nil {
+			c.metrics.WSReconnect(c.getBaseURL())
+		}
+	}
+
 	// 创建新的WebSocket连接，使用Client配置的回调函数
 	c.wsClient = NewWSClient(WSConfig{
-		BaseURL:     c.getBaseURL(),
-		ClientID:    c.clientID,
-		Username:    c.getUsername(),
-		Password:    c.getPassword(),
-		OnProgress:  c.onProgress,
-		OnStatus:    c.onStatus,
-		OnExecution: c.onExecution,
-		OnError:     c.onError,
+		BaseURL:      c.apiURL(),
+		ClientID:     c.clientID,
+		Auth:         c.auth,
+		HTTPClient:   c.httpClient(),
+		Logger:       c.log(),
+		Tracer:       c.tracer,
+		Capabilities: caps,
+		OnProgress:   c.onProgress,
+		OnStatus:     c.onStatus,
+		OnExecution:  c.onExecution,
+		OnError:      c.onError,
+		OnMessage:    c.dispatchWSMessage,
 	})
 
 	return c.wsClient.Connect(ctx)
@@ -269,3 +459,34 @@ func (c *Client) CloseWebSocket() error {
 func (c *Client) IsWebSocketEnabled() bool {
 	return c.wsEnabled
 }
+
+// addWSListener 注册一个接收所有WebSocket消息的内部监听器，返回注销函数
+func (c *Client) addWSListener(fn func(WSMessage)) func() {
+	c.listenersMu.Lock()
+	defer c.listenersMu.Unlock()
+	if c.listeners == nil {
+		c.listeners = make(map[int]func(WSMessage))
+	}
+	id := c.nextListen
+	c.nextListen++
+	c.listeners[id] = fn
+	return func() {
+		c.listenersMu.Lock()
+		delete(c.listeners, id)
+		c.listenersMu.Unlock()
+	}
+}
+
+// dispatchWSMessage 将WebSocket消息分发给所有内部监听器
+func (c *Client) dispatchWSMessage(msg WSMessage) {
+	c.listenersMu.RLock()
+	fns := make([]func(WSMessage), 0, len(c.listeners))
+	for _, fn := range c.listeners {
+		fns = append(fns, fn)
+	}
+	c.listenersMu.RUnlock()
+
+	for _, fn := range fns {
+		fn(msg)
+	}
+}
@@ -3,7 +3,6 @@ package main // concurrent_tasks
 import (
 	"context"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/deferz/comfyui2go"
@@ -23,83 +22,48 @@ func main() {
 		"a dog running in the park",
 		"a bird flying in the sky",
 	}
+	workflows := make([]comfyui2go.JSON, len(prompts))
+	for i, prompt := range prompts {
+		workflows[i] = createWorkflow(prompt)
+	}
 
 	fmt.Printf("🚀 开始并发处理 %d 个任务...\n", len(prompts))
 
-	// 使用 WaitGroup 来等待所有任务完成
-	var wg sync.WaitGroup
-	results := make(chan string, len(prompts))
-	errors := make(chan error, len(prompts))
-
-	for i, prompt := range prompts {
-		wg.Add(1)
-		go func(taskID int, promptText string) {
-			defer wg.Done()
-
-			err := processTask(client, taskID, promptText)
-			if err != nil {
-				errors <- fmt.Errorf("任务 %d 失败: %v", taskID, err)
-			} else {
-				results <- fmt.Sprintf("任务 %d 完成", taskID)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// 最多同时提交 2 个任务，单个任务失败不影响其余任务
+	results, err := client.Batch(ctx, workflows,
+		comfyui2go.WithBatchConcurrency(2),
+		comfyui2go.WithBatchProgress(func(p comfyui2go.BatchProgress, item comfyui2go.BatchResult) {
+			switch {
+			case item.Err != nil:
+				fmt.Printf("❌ 任务 %d 失败: %v\n", item.Index+1, item.Err)
+			case item.Result != nil:
+				fmt.Printf("✅ 任务 %d 完成 (%s)\n", item.Index+1, item.PromptID)
+			default:
+				fmt.Printf("📤 任务 %d: 已提交 '%s'\n", item.Index+1, prompts[item.Index])
 			}
-		}(i+1, prompt)
-	}
-
-	// 等待所有任务完成
-	go func() {
-		wg.Wait()
-		close(results)
-		close(errors)
-	}()
+			fmt.Printf("📊 进度: %d/%d\n", p.Finished(), p.Total)
+		}),
+	)
 
-	// 收集结果
+	// 结果按输入顺序排列
 	var completed, failed int
-	for {
-		select {
-		case result, ok := <-results:
-			if !ok && len(errors) == 0 {
-				goto done
-			}
-			if ok {
-				fmt.Printf("✅ %s\n", result)
-				completed++
-			}
-		case err, ok := <-errors:
-			if !ok {
-				continue
-			}
-			fmt.Printf("❌ %v\n", err)
+	for _, r := range results {
+		if r.Err != nil {
 			failed++
+			continue
 		}
+		completed++
+		fmt.Printf("🎉 '%s': %d 个输出文件\n", prompts[r.Index], len(r.Result.Item.Assets()))
 	}
-
-done:
-	fmt.Printf("🎯 处理完成! 成功: %d, 失败: %d\n", completed, failed)
-	fmt.Println("📊 注意: 所有任务共享同一个WebSocket连接")
-}
-
-func processTask(client *comfyui2go.Client, taskID int, promptText string) error {
-	ctx := context.Background()
-
-	// 创建工作流（简化版本）
-	workflow := createWorkflow(promptText)
-
-	fmt.Printf("📤 任务 %d: 提交工作流 '%s'\n", taskID, promptText)
-
-	// 提交工作流
-	promptID, err := client.Prompt(ctx, workflow)
-	if err != nil {
-		return fmt.Errorf("提交失败: %v", err)
-	}
-
-	// 使用WebSocket等待完成（连接会自动复用）
-	result, err := client.WaitForCompletionWithWS(ctx, promptID, 3*time.Minute)
 	if err != nil {
-		return fmt.Errorf("执行失败: %v", err)
+		fmt.Printf("⚠️ 部分任务失败: %v\n", err)
 	}
 
-	fmt.Printf("🎉 任务 %d: 生成完成 (%s)\n", taskID, result.PromptID)
-	return nil
+	fmt.Printf("🎯 处理完成! 成功: %d, 失败: %d\n", completed, failed)
+	fmt.Println("📊 注意: 所有任务共享同一个WebSocket连接")
 }
 
 func createWorkflow(promptText string) comfyui2go.JSON {
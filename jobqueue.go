@@ -0,0 +1,1091 @@
+package comfyui2go
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrJobCancelled 表示任务已被取消。
+var ErrJobCancelled = errors.New("job cancelled")
+
+// ErrJobQueueClosed 表示任务队列已关闭，无法再提交任务。
+var ErrJobQueueClosed = errors.New("job queue closed")
+
+// JobState 任务状态
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"    // 在本地队列中等待分发
+	JobSubmitted JobState = "submitted" // 已提交到服务器，在服务器队列中等待
+	JobRunning   JobState = "running"   // 服务器正在执行
+	JobSucceeded JobState = "succeeded" // 执行成功
+	JobFailed    JobState = "failed"    // 执行失败
+	JobCancelled JobState = "cancelled" // 已取消
+)
+
+// IsTerminal 判断状态是否为终态
+func (s JobState) IsTerminal() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// JobEvent 任务事件，状态变化、执行节点变化和进度更新都会产生事件
+type JobEvent struct {
+	JobID    string
+	State    JobState
+	PromptID string
+	// Node 为当前执行的节点ID（仅执行中的节点事件）
+	Node *string
+	// Progress 为节点内进度（仅进度事件）
+	Progress *WSProgressMessage
+	// Err 为失败或取消的原因（仅终态事件）
+	Err  error
+	Time time.Time
+}
+
+// JobOption 用于自定义单个任务
+type JobOption func(*Job)
+
+// WithPriority 设置任务优先级，数值越大越先分发（默认 0）
+func WithPriority(priority int) JobOption {
+	return func(j *Job) { j.priority = priority }
+}
+
+// WithTenant 设置任务所属租户，同一优先级内不同租户轮流分发
+func WithTenant(tenant string) JobOption {
+	return func(j *Job) { j.tenant = tenant }
+}
+
+// WithJobID 使用调用方指定的任务ID（默认随机生成）
+func WithJobID(id string) JobOption {
+	return func(j *Job) { j.id = id }
+}
+
+// Job 是任务队列中单个任务的句柄
+type Job struct {
+	id       string
+	workflow JSON
+	priority int
+	tenant   string
+	seq      uint64
+	queue    *JobQueue
+
+	// 路由检查失败后的退避，由 JobQueue.mu 保护
+	routeRetryAt time.Time
+	routeBackoff time.Duration
+
+	mu       sync.Mutex
+	state    JobState
+	client   *Client
+	promptID string
+	result   *WaitResult
+	err      error
+	subs     map[int]chan JobEvent
+	nextSub  int
+	done     chan struct{}
+	cancel   context.CancelFunc
+	unlisten func()
+
+	// persistMu 保证状态记录按变化顺序写入 JobStore，在持有 mu 时获取
+	persistMu sync.Mutex
+}
+
+// ID 返回任务ID
+func (j *Job) ID() string { return j.id }
+
+// Priority 返回任务优先级
+func (j *Job) Priority() int { return j.priority }
+
+// Tenant 返回任务所属租户
+func (j *Job) Tenant() string { return j.tenant }
+
+// Workflow 返回任务的工作流
+func (j *Job) Workflow() JSON { return j.workflow }
+
+// State 返回任务当前状态
+func (j *Job) State() JobState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+// PromptID 返回服务器分配的 prompt_id（提交前为空）
+func (j *Job) PromptID() string {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.promptID
+}
+
+// Client 返回执行该任务的客户端（分发前为 nil）
+func (j *Job) Client() *Client {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.client
+}
+
+// Done 返回在任务进入终态时关闭的通道
+func (j *Job) Done() <-chan struct{} { return j.done }
+
+// Wait 等待任务结束并返回结果；ctx 取消只结束等待，不会取消任务
+func (j *Job) Wait(ctx context.Context) (*WaitResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-j.done:
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.result, j.err
+}
+
+// Subscribe 订阅任务事件，返回事件通道和取消订阅函数。
+// 任务结束后通道会被关闭；消费过慢时会丢弃中间的进度事件，但不会丢弃终态事件。
+func (j *Job) Subscribe() (<-chan JobEvent, func()) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	ch := make(chan JobEvent, 64)
+	if j.state.IsTerminal() {
+		ch <- JobEvent{JobID: j.id, State: j.state, PromptID: j.promptID, Err: j.err, Time: time.Now()}
+		close(ch)
+		return ch, func() {}
+	}
+	if j.subs == nil {
+		j.subs = make(map[int]chan JobEvent)
+	}
+	id := j.nextSub
+	j.nextSub++
+	j.subs[id] = ch
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if c, ok := j.subs[id]; ok {
+			delete(j.subs, id)
+			close(c)
+		}
+	}
+}
+
+// Cancel 取消任务：本地排队中的任务直接移除；已提交的任务会从服务器队列删除，执行中的任务会被中断
+func (j *Job) Cancel(ctx context.Context) error {
+	return j.queue.cancel(ctx, j)
+}
+
+// emitLocked 向所有订阅者发送事件，调用方需持有 j.mu
+func (j *Job) emitLocked(ev JobEvent) {
+	ev.JobID = j.id
+	ev.PromptID = j.promptID
+	if ev.State == "" {
+		ev.State = j.state
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	for _, ch := range j.subs {
+		if ev.State.IsTerminal() {
+			// 终态事件必须送达：腾出空间后再发送
+			select {
+			case ch <- ev:
+			default:
+				select {
+				case <-ch:
+				default:
+				}
+				ch <- ev
+			}
+			continue
+		}
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// setState 更新任务状态并通知订阅者，终态只能设置一次
+func (j *Job) setState(state JobState) bool {
+	j.mu.Lock()
+	if j.state.IsTerminal() || j.state == state {
+		j.mu.Unlock()
+		return false
+	}
+	j.state = state
+	j.emitLocked(JobEvent{State: state})
+	persist := j.queue.transitionLocked(j)
+	j.mu.Unlock()
+	persist()
+	return true
+}
+
+// finish 将任务置为终态，返回是否由本次调用完成
+func (j *Job) finish(state JobState, result *WaitResult, err error) bool {
+	j.mu.Lock()
+	if j.state.IsTerminal() {
+		j.mu.Unlock()
+		return false
+	}
+	j.state = state
+	j.result = result
+	j.err = err
+	j.emitLocked(JobEvent{State: state, Err: err})
+	for id, ch := range j.subs {
+		close(ch)
+		delete(j.subs, id)
+	}
+	persist := j.queue.transitionLocked(j)
+	cancel, unlisten := j.cancel, j.unlisten
+	j.mu.Unlock()
+	persist()
+
+	if unlisten != nil {
+		unlisten()
+	}
+	if cancel != nil {
+		cancel()
+	}
+	close(j.done)
+	return true
+}
+
+// JobQueueOption 用于自定义 JobQueue
+type JobQueueOption func(*JobQueue)
+
+// WithMaxInFlight 设置每台服务器同时在途（已提交未结束）的 prompt 数量上限（默认 1）
+func WithMaxInFlight(n int) JobQueueOption {
+	return func(q *JobQueue) {
+		if n > 0 {
+			q.maxInFlight = n
+		}
+	}
+}
+
+// WithJobRouter 使用 Router 按节点和模型能力为任务挑选服务器。
+// 所有服务器都可达但都不满足需求时任务失败（*NoEligibleServerError）；
+// 服务器暂时不可达时任务留在本地队列，退避后重试。
+func WithJobRouter(r *Router) JobQueueOption {
+	return func(q *JobQueue) { q.router = r }
+}
+
+// WithJobPollInterval 设置轮询 /history 的间隔（默认 1 秒；WebSocket 可用时作为兜底放慢为 5 倍）
+func WithJobPollInterval(d time.Duration) JobQueueOption {
+	return func(q *JobQueue) {
+		if d > 0 {
+			q.pollEvery = d
+		}
+	}
+}
+
+// WithJobStore 使用 JobStore 记录任务的提交与状态变化，配合 Recover 在重启后恢复任务
+func WithJobStore(store JobStore) JobQueueOption {
+	return func(q *JobQueue) { q.store = store }
+}
+
+// JobResultHandler 在服务器端执行成功后处理结果（如下载输出文件）；返回错误时任务标记为失败。
+// 处理完成前任务不会被记录为成功，因此重启恢复后会重新执行处理。
+type JobResultHandler func(ctx context.Context, job *Job, result *WaitResult) error
+
+// WithJobResultHandler 设置任务结果处理函数
+func WithJobResultHandler(h JobResultHandler) JobQueueOption {
+	return func(q *JobQueue) { q.onResult = h }
+}
+
+// JobQueue 在一个或多个客户端前维护本地任务队列：按优先级分发、同优先级内按租户公平轮转，
+// 并限制每台服务器的在途 prompt 数量。
+type JobQueue struct {
+	clients     []*Client
+	router      *Router
+	maxInFlight int
+	pollEvery   time.Duration
+
+	store    JobStore
+	onResult JobResultHandler
+	storeMu  sync.Mutex
+	storeErr error // 最近一次写日志失败的错误
+
+	mu       sync.Mutex
+	pending  []*Job
+	jobs     map[string]*Job
+	inFlight map[*Client]int
+	served   map[string]uint64
+	seq      uint64
+	closed   bool
+
+	wake chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewJobQueue 创建任务队列并启动分发协程
+func NewJobQueue(clients []*Client, opts ...JobQueueOption) *JobQueue {
+	q := &JobQueue{
+		clients:     clients,
+		maxInFlight: 1,
+		pollEvery:   time.Second,
+		jobs:        make(map[string]*Job),
+		inFlight:    make(map[*Client]int),
+		served:      make(map[string]uint64),
+		wake:        make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(q)
+	}
+	if q.router != nil && len(q.clients) == 0 {
+		q.clients = q.router.Clients()
+	}
+
+	q.wg.Add(1)
+	go q.dispatchLoop()
+	return q
+}
+
+// Submit 将工作流加入本地队列并返回任务句柄
+func (q *JobQueue) Submit(workflow JSON, opts ...JobOption) (*Job, error) {
+	j := newJob(q, workflow, opts...)
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return nil, ErrJobQueueClosed
+	}
+	if _, exists := q.jobs[j.id]; exists {
+		q.mu.Unlock()
+		return nil, fmt.Errorf("job %s already exists", j.id)
+	}
+	q.seq++
+	j.seq = q.seq
+	q.jobs[j.id] = j
+	q.pending = append(q.pending, j)
+	q.mu.Unlock()
+
+	j.mu.Lock()
+	persist := q.transitionLocked(j)
+	j.mu.Unlock()
+	persist()
+	q.signal()
+	return j, nil
+}
+
+func newJob(q *JobQueue, workflow JSON, opts ...JobOption) *Job {
+	j := &Job{
+		workflow: workflow,
+		queue:    q,
+		state:    JobQueued,
+		done:     make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(j)
+	}
+	if j.id == "" {
+		j.id = newJobID()
+	}
+	return j
+}
+
+// newJobID 生成随机任务ID
+func newJobID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("job-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// Job 按ID查找任务（包括已结束的任务）
+func (q *JobQueue) Job(id string) (*Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	return j, ok
+}
+
+// Jobs 返回队列中全部任务（包括已结束的任务）
+func (q *JobQueue) Jobs() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]*Job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		out = append(out, j)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].seq < out[b].seq })
+	return out
+}
+
+// Forget 从队列的任务索引中移除已结束的任务，避免长期运行时占用内存
+func (q *JobQueue) Forget(id string) {
+	j, ok := q.Job(id)
+	if !ok || !j.State().IsTerminal() {
+		return
+	}
+	q.mu.Lock()
+	delete(q.jobs, id)
+	q.mu.Unlock()
+}
+
+// Pending 返回本地排队中的任务数量
+func (q *JobQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// InFlight 返回指定客户端当前在途的 prompt 数量
+func (q *JobQueue) InFlight(c *Client) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.inFlight[c]
+}
+
+// Close 停止分发并取消所有本地排队中的任务；已提交的任务会继续执行直到结束
+func (q *JobQueue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	pending := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	close(q.stop)
+	q.wg.Wait()
+	for _, j := range pending {
+		j.finish(JobCancelled, nil, ErrJobQueueClosed)
+	}
+}
+
+func (q *JobQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// 路由检查（拉取 /object_info、/models）的超时，以及服务器暂时不可达时的重试退避
+const (
+	routeTimeout    = 30 * time.Second
+	routeMinBackoff = time.Second
+	routeMaxBackoff = 30 * time.Second
+)
+
+// dispatchLoop 不断尝试分发任务，直到队列关闭
+func (q *JobQueue) dispatchLoop() {
+	defer q.wg.Done()
+	for {
+		for q.dispatchOne() {
+		}
+		var retry <-chan time.Time
+		var timer *time.Timer
+		if d, ok := q.nextRouteRetry(); ok {
+			timer = time.NewTimer(d)
+			retry = timer.C
+		}
+		select {
+		case <-q.stop:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-q.wake:
+		case <-retry:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// nextRouteRetry 返回距离最早一个退避中的任务可以重试的时间
+func (q *JobQueue) nextRouteRetry() (time.Duration, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var earliest time.Time
+	for _, j := range q.pending {
+		if !j.routeRetryAt.IsZero() && (earliest.IsZero() || j.routeRetryAt.Before(earliest)) {
+			earliest = j.routeRetryAt
+		}
+	}
+	if earliest.IsZero() {
+		return 0, false
+	}
+	return time.Until(earliest), true
+}
+
+// route 在限定时间内检查可运行该任务的服务器，队列关闭时立即取消
+func (q *JobQueue) route(j *Job) ([]*Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), routeTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-q.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return q.router.Eligible(ctx, j.workflow)
+}
+
+// routeFailed 处理路由检查失败：所有服务器都可达但都不满足需求时任务失败，
+// 否则（服务器暂时不可达、检查超时）任务留在本地队列，按指数退避稍后重试。返回任务是否被移出队列。
+func (q *JobQueue) routeFailed(j *Job, err error) bool {
+	var none *NoEligibleServerError
+	if errors.As(err, &none) && len(none.Unreachable) == 0 {
+		if q.removePending(j) {
+			j.finish(JobFailed, nil, err)
+		}
+		return true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	switch {
+	case j.routeBackoff == 0:
+		j.routeBackoff = routeMinBackoff
+	case j.routeBackoff < routeMaxBackoff:
+		j.routeBackoff = min(j.routeBackoff*2, routeMaxBackoff)
+	}
+	j.routeRetryAt = time.Now().Add(j.routeBackoff)
+	return false
+}
+
+// orderedPending 按优先级、租户公平性和提交顺序排列待分发任务
+func (q *JobQueue) orderedPending() []*Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	out := make([]*Job, len(q.pending))
+	copy(out, q.pending)
+	sort.SliceStable(out, func(a, b int) bool {
+		ja, jb := out[a], out[b]
+		if ja.priority != jb.priority {
+			return ja.priority > jb.priority
+		}
+		// 同优先级内，最近最少被服务的租户优先
+		if sa, sb := q.served[ja.tenant], q.served[jb.tenant]; sa != sb {
+			return sa < sb
+		}
+		return ja.seq < jb.seq
+	})
+	return out
+}
+
+// dispatchOne 尝试分发一个任务，返回是否有任务被分发或移出队列
+func (q *JobQueue) dispatchOne() bool {
+	now := time.Now()
+	for _, j := range q.orderedPending() {
+		select {
+		case <-q.stop:
+			return false
+		default:
+		}
+
+		q.mu.Lock()
+		waiting := j.routeRetryAt.After(now)
+		q.mu.Unlock()
+		if waiting {
+			continue
+		}
+
+		candidates := q.clients
+		if q.router != nil {
+			eligible, err := q.route(j)
+			if err != nil {
+				if q.routeFailed(j, err) {
+					return true
+				}
+				continue
+			}
+			q.mu.Lock()
+			j.routeRetryAt, j.routeBackoff = time.Time{}, 0
+			q.mu.Unlock()
+			candidates = eligible
+		}
+
+		c := q.reserve(j, candidates)
+		if c == nil {
+			// 该任务暂无空闲服务器，尝试下一个任务（其可用服务器可能不同）
+			continue
+		}
+		go q.run(j, c, "")
+		return true
+	}
+	return false
+}
+
+// reserve 在候选客户端中选择在途数量最少且未满的一个，并将任务移出本地队列
+func (q *JobQueue) reserve(j *Job, candidates []*Client) *Client {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var best *Client
+	for _, c := range candidates {
+		n := q.inFlight[c]
+		if n >= q.maxInFlight {
+			continue
+		}
+		if best == nil || n < q.inFlight[best] {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	if !q.removePendingLocked(j) {
+		// 任务已在别处被取消
+		return nil
+	}
+	q.acquireLocked(best)
+	q.seq++
+	q.served[j.tenant] = q.seq
+	return best
+}
+
+// acquireLocked 占用服务器的一个在途名额，与 release 成对使用，调用方需持有 q.mu。
+// 恢复的任务已在服务器上，即使超出 maxInFlight 也必须计入，新任务会等到名额回落后再分发。
+func (q *JobQueue) acquireLocked(c *Client) {
+	q.inFlight[c]++
+}
+
+func (q *JobQueue) removePending(j *Job) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.removePendingLocked(j)
+}
+
+func (q *JobQueue) removePendingLocked(j *Job) bool {
+	for i, p := range q.pending {
+		if p == j {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release 归还服务器的在途名额
+func (q *JobQueue) release(c *Client) {
+	q.mu.Lock()
+	q.inFlight[c]--
+	q.mu.Unlock()
+	q.signal()
+}
+
+// run 提交任务（promptID 为空时）或重新关联已提交的 prompt，并跟踪其执行直到结束
+func (q *JobQueue) run(j *Job, c *Client, promptID string) {
+	defer q.release(c)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan WSMessage, 64)
+
+	j.mu.Lock()
+	if j.state.IsTerminal() {
+		j.mu.Unlock()
+		cancel()
+		return
+	}
+	j.client = c
+	j.cancel = cancel
+	j.mu.Unlock()
+
+	if c.IsWebSocketEnabled() {
+		// 监听器挂在 Client 上，WebSocket 重连后依然有效；连接失败时退化为纯轮询
+		unlisten := c.addWSListener(func(msg WSMessage) {
+			select {
+			case events <- msg:
+			default:
+				c.log().Debug("comfyui websocket event dropped", "job_id", j.id, "type", msg.Type)
+			}
+		})
+		j.mu.Lock()
+		j.unlisten = unlisten
+		j.mu.Unlock()
+		q.connectWebSocket(c)
+	}
+
+	if promptID != "" {
+		q.track(ctx, j, c, promptID, events, 0)
+		return
+	}
+
+	// 提交请求不随任务取消而中断：服务器可能已经接受，必须拿到 prompt_id 才能撤回
+	promptID, err := c.Prompt(context.WithoutCancel(ctx), j.workflow)
+	if err != nil {
+		if ctx.Err() != nil {
+			j.finish(JobCancelled, nil, ErrJobCancelled)
+			return
+		}
+		j.finish(JobFailed, nil, err)
+		return
+	}
+	j.mu.Lock()
+	cancelled := j.state.IsTerminal()
+	if !cancelled {
+		j.promptID = promptID
+	}
+	j.mu.Unlock()
+	if cancelled {
+		// 提交期间任务已被取消，撤回服务器上的 prompt，避免无人跟踪的任务继续占用服务器
+		ictx, icancel := context.WithTimeout(context.Background(), routeTimeout)
+		defer icancel()
+		if err := c.InterruptPrompt(ictx, promptID); err != nil {
+			c.log().Warn("comfyui cancelled job left on server", "job_id", j.id, "prompt_id", promptID, "error", err)
+		}
+		return
+	}
+	j.setState(JobSubmitted)
+
+	q.track(ctx, j, c, promptID, events, q.pollInterval(c))
+}
+
+// track 结合 WebSocket 事件和 /history 轮询跟踪 prompt 直到结束
+func (q *JobQueue) track(ctx context.Context, j *Job, c *Client, promptID string, events <-chan WSMessage, firstPoll time.Duration) {
+	timer := time.NewTimer(firstPoll)
+	defer timer.Stop()
+
+	// 收到结束事件后历史记录可能尚未写入，短时间内快速重试
+	var execErr *ExecutionError
+	fastRetries := 0
+	finished := func() {
+		fastRetries = 10
+		resetTimer(timer, 0)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			j.finish(JobCancelled, nil, ErrJobCancelled)
+			return
+		case msg := <-events:
+			id, _ := msg.Data["prompt_id"].(string)
+			if id != "" && id != promptID {
+				continue
+			}
+			switch msg.Type {
+			case "execution_start":
+				j.setState(JobRunning)
+			case "executing":
+				if id == "" {
+					continue
+				}
+				node, _ := msg.Data["node"].(string)
+				if node == "" {
+					// 执行结束，尽快查询历史记录
+					finished()
+					continue
+				}
+				j.setState(JobRunning)
+				j.mu.Lock()
+				j.emitLocked(JobEvent{Node: &node})
+				j.mu.Unlock()
+			case "progress", "progress_state":
+				// 旧版本服务器的进度消息不带 prompt_id，只在任务执行中时转发
+				for _, p := range progressFor(c.cachedCapabilities(), msg, promptID, j.State() == JobRunning) {
+					p := p
+					j.mu.Lock()
+					j.emitLocked(JobEvent{Progress: &p})
+					j.mu.Unlock()
+				}
+			case "execution_success", "execution_interrupted":
+				finished()
+			case "execution_error":
+				execErr = executionErrorFrom(msg.Type, msg.Data)
+				finished()
+			}
+		case <-timer.C:
+			h, err := c.GetHistory(ctx, promptID)
+			if err != nil {
+				if ctx.Err() != nil {
+					continue
+				}
+				resetTimer(timer, q.pollInterval(c))
+				continue
+			}
+			item, ok := h[promptID]
+			if !ok || !item.Finished() {
+				if fastRetries > 0 {
+					fastRetries--
+					resetTimer(timer, 200*time.Millisecond)
+					continue
+				}
+				// 没有收到 execution_start 时（如未启用 WebSocket）从 /queue 判断是否已开始执行
+				if j.State() == JobSubmitted {
+					if queue, err := c.GetQueue(ctx); err == nil && queueContains(queue.QueueRunning, promptID) {
+						j.setState(JobRunning)
+					}
+				}
+				// WebSocket 断开后尝试重连
+				if c.IsWebSocketEnabled() && !c.IsWebSocketConnected() {
+					q.connectWebSocket(c)
+				}
+				resetTimer(timer, q.pollInterval(c))
+				continue
+			}
+			c.observeHistory(promptID, item)
+			result := &WaitResult{PromptID: promptID, Item: item}
+			if failure := historyFailure(promptID, item); failure != nil {
+				// 历史记录中的失败信息更完整；只有状态时保留 WebSocket 事件中的节点信息
+				if execErr != nil && failure.NodeID == "" {
+					failure = execErr
+				}
+				j.finish(JobFailed, result, failure)
+				return
+			}
+			if q.onResult != nil {
+				if err := q.onResult(ctx, j, result); err != nil {
+					if ctx.Err() != nil {
+						j.finish(JobCancelled, result, ErrJobCancelled)
+						return
+					}
+					j.finish(JobFailed, result, err)
+					return
+				}
+			}
+			j.finish(JobSucceeded, result, nil)
+			return
+		}
+	}
+}
+
+// connectWebSocket 建立客户端的 WebSocket 连接。连接由该客户端上的所有任务共享，
+// 不使用单个任务的 ctx，任务结束或取消不会中断握手；握手最长等待 routeTimeout。
+func (q *JobQueue) connectWebSocket(c *Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), routeTimeout)
+	defer cancel()
+	_ = c.ensureWebSocketConnected(ctx)
+}
+
+// pollInterval 返回轮询间隔：WebSocket 已连接时轮询只作兜底，放慢为 5 倍
+func (q *JobQueue) pollInterval(c *Client) time.Duration {
+	if c.IsWebSocketConnected() {
+		return 5 * q.pollEvery
+	}
+	return q.pollEvery
+}
+
+// resetTimer 安全地重置定时器
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// cancel 取消任务
+func (q *JobQueue) cancel(ctx context.Context, j *Job) error {
+	if q.removePending(j) {
+		j.finish(JobCancelled, nil, ErrJobCancelled)
+		q.signal()
+		return nil
+	}
+
+	j.mu.Lock()
+	state, c, promptID := j.state, j.client, j.promptID
+	j.mu.Unlock()
+
+	if state.IsTerminal() {
+		return nil
+	}
+	if c != nil && promptID != "" {
+		if err := c.InterruptPrompt(ctx, promptID); err != nil {
+			return err
+		}
+	}
+	if !j.finish(JobCancelled, nil, ErrJobCancelled) || promptID != "" {
+		return nil
+	}
+	// 取消时提交请求可能仍在进行：prompt_id 在任务结束前写入的由这里撤回，否则由 run 在提交返回后撤回
+	j.mu.Lock()
+	c, promptID = j.client, j.promptID
+	j.mu.Unlock()
+	if c != nil && promptID != "" {
+		return c.InterruptPrompt(ctx, promptID)
+	}
+	return nil
+}
+
+// transitionLocked 生成任务的最新状态记录，调用方需持有 j.mu。
+// 返回的函数在释放 j.mu 后调用，负责写入 JobStore，落盘与压缩不会阻塞任务的其他操作。
+func (q *JobQueue) transitionLocked(j *Job) func() {
+	if q == nil || q.store == nil {
+		return func() {}
+	}
+	rec := JobRecord{
+		JobID:    j.id,
+		State:    j.state,
+		PromptID: j.promptID,
+		Time:     time.Now(),
+	}
+	if j.client != nil {
+		rec.Server = j.client.getBaseURL()
+	}
+	if j.state == JobQueued {
+		// 工作流只在入队时记录一次
+		rec.Workflow = j.workflow
+		rec.Priority = j.priority
+		rec.Tenant = j.tenant
+	}
+	if j.err != nil {
+		rec.Error = j.err.Error()
+	}
+	// 释放 j.mu 前占住 persistMu，同一任务的记录不会乱序
+	j.persistMu.Lock()
+	return func() {
+		defer j.persistMu.Unlock()
+		if err := q.store.Append(rec); err != nil {
+			q.storeMu.Lock()
+			q.storeErr = err
+			q.storeMu.Unlock()
+		}
+	}
+}
+
+// StoreErr 返回最近一次写任务日志失败的错误（没有则为 nil）
+func (q *JobQueue) StoreErr() error {
+	q.storeMu.Lock()
+	defer q.storeMu.Unlock()
+	return q.storeErr
+}
+
+// ErrPromptLost 表示恢复时服务器的队列和历史记录中都找不到该 prompt（如服务器也已重启）。
+var ErrPromptLost = errors.New("prompt lost")
+
+// Recover 从 JobStore 恢复未结束的任务，应在提交新任务之前调用：
+//   - 尚未提交的任务重新进入本地队列；
+//   - 已提交的任务通过 /history 和 /queue 找回，并继续等待（以及执行结果处理函数）；
+//   - 服务器上已找不到的任务标记为失败（ErrPromptLost）。
+//
+// 若进程在提交成功与写入日志之间崩溃，该任务会被重新提交（至少一次语义）。
+func (q *JobQueue) Recover(ctx context.Context) ([]*Job, error) {
+	if q.store == nil {
+		return nil, fmt.Errorf("job store not configured")
+	}
+	records, err := q.store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	var recovered []*Job
+	for _, rec := range records {
+		if rec.State.IsTerminal() {
+			continue
+		}
+		q.mu.Lock()
+		_, exists := q.jobs[rec.JobID]
+		q.mu.Unlock()
+		if exists {
+			continue
+		}
+
+		j := newJob(q, rec.Workflow, WithJobID(rec.JobID), WithPriority(rec.Priority), WithTenant(rec.Tenant))
+		j.promptID = rec.PromptID
+
+		c := q.clientByURL(rec.Server)
+		if rec.PromptID == "" || c == nil {
+			if rec.PromptID != "" {
+				// 执行该任务的服务器已不在配置中，无法找回
+				q.register(j, false)
+				j.finish(JobFailed, nil, fmt.Errorf("%w: server %s not configured", ErrPromptLost, rec.Server))
+				recovered = append(recovered, j)
+				continue
+			}
+			j.state = JobQueued
+			q.register(j, true)
+			recovered = append(recovered, j)
+			continue
+		}
+
+		state, err := q.locatePrompt(ctx, c, rec.PromptID)
+		if err != nil {
+			return recovered, err
+		}
+		j.client = c
+		if state != "" {
+			// 注册后任务即对 Get、List 和 Cancel 可见，状态必须先设置好
+			j.state = state
+		}
+		q.register(j, false)
+		recovered = append(recovered, j)
+		if state == "" {
+			j.finish(JobFailed, nil, fmt.Errorf("%w: %s", ErrPromptLost, rec.PromptID))
+			continue
+		}
+
+		// 与 reserve 相同的在途计数，由 run 结束时的 release 归还
+		q.mu.Lock()
+		q.acquireLocked(c)
+		q.mu.Unlock()
+		go q.run(j, c, rec.PromptID)
+	}
+	q.signal()
+	return recovered, nil
+}
+
+// register 将恢复的任务加入索引，pending 为 true 时同时加入本地队列
+func (q *JobQueue) register(j *Job, pending bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	j.seq = q.seq
+	q.jobs[j.id] = j
+	if pending {
+		q.pending = append(q.pending, j)
+	}
+}
+
+// clientByURL 根据服务器地址查找客户端
+func (q *JobQueue) clientByURL(server string) *Client {
+	if server == "" {
+		return nil
+	}
+	for _, c := range q.clients {
+		if c.getBaseURL() == server {
+			return c
+		}
+	}
+	return nil
+}
+
+// locatePrompt 判断 prompt 在服务器上的状态：已有历史记录或正在执行为 running，
+// 仍在等待为 submitted，都找不到时返回空字符串
+func (q *JobQueue) locatePrompt(ctx context.Context, c *Client, promptID string) (JobState, error) {
+	h, err := c.GetHistory(ctx, promptID)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := h[promptID]; ok {
+		return JobRunning, nil
+	}
+	queue, err := c.GetQueue(ctx)
+	if err != nil {
+		return "", err
+	}
+	if queueContains(queue.QueueRunning, promptID) {
+		return JobRunning, nil
+	}
+	if queueContains(queue.QueuePending, promptID) {
+		return JobSubmitted, nil
+	}
+	return "", nil
+}
+
+// queueContains 判断队列条目中是否包含指定 prompt。
+// 每个条目形如 [number, prompt_id, prompt, extra_data, outputs_to_execute]。
+func queueContains(items []interface{}, promptID string) bool {
+	for _, item := range items {
+		fields, ok := item.([]interface{})
+		if !ok || len(fields) < 2 {
+			continue
+		}
+		if id, _ := fields[1].(string); id == promptID {
+			return true
+		}
+	}
+	return false
+}
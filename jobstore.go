@@ -0,0 +1,251 @@
+package comfyui2go
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// JobRecord 是任务日志中的一条记录。
+// 同一任务的多条记录按顺序合并：非空字段覆盖旧值，State 总是取最新值。
+type JobRecord struct {
+	JobID    string   `json:"job_id"`
+	State    JobState `json:"state"`
+	PromptID string   `json:"prompt_id,omitempty"`
+	// Server 为执行任务的服务器地址（Client 的 baseURL），用于重启后找回对应客户端
+	Server   string    `json:"server,omitempty"`
+	Priority int       `json:"priority,omitempty"`
+	Tenant   string    `json:"tenant,omitempty"`
+	Workflow JSON      `json:"workflow,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// JobStore 持久化任务的提交与状态变化，使进程重启后能恢复跟踪。
+type JobStore interface {
+	// Append 追加一条记录
+	Append(rec JobRecord) error
+	// Load 返回每个任务合并后的最新记录，按首次出现顺序排列
+	Load() ([]JobRecord, error)
+}
+
+// mergeJobRecords 按任务ID合并记录
+func mergeJobRecords(records []JobRecord) []JobRecord {
+	index := make(map[string]int)
+	var out []JobRecord
+	for _, rec := range records {
+		i, ok := index[rec.JobID]
+		if !ok {
+			index[rec.JobID] = len(out)
+			out = append(out, rec)
+			continue
+		}
+		cur := &out[i]
+		cur.State = rec.State
+		cur.Time = rec.Time
+		cur.Error = rec.Error
+		if rec.PromptID != "" {
+			cur.PromptID = rec.PromptID
+		}
+		if rec.Server != "" {
+			cur.Server = rec.Server
+		}
+		if rec.Priority != 0 {
+			cur.Priority = rec.Priority
+		}
+		if rec.Tenant != "" {
+			cur.Tenant = rec.Tenant
+		}
+		if rec.Workflow != nil {
+			cur.Workflow = rec.Workflow
+		}
+	}
+	return out
+}
+
+// FileJobStoreOption 用于自定义 FileJobStore
+type FileJobStoreOption func(*FileJobStore)
+
+// WithCompactEvery 设置追加多少条记录后自动压缩日志（默认 1000，<=0 表示不自动压缩）
+func WithCompactEvery(n int) FileJobStoreOption {
+	return func(s *FileJobStore) { s.compactEvery = n }
+}
+
+// FileJobStore 是基于 JSON Lines 追加日志的 JobStore 默认实现。
+// 压缩时只保留未结束任务的合并记录。
+type FileJobStore struct {
+	path         string
+	compactEvery int
+
+	mu       sync.Mutex
+	file     *os.File // 压缩后重新打开失败时为 nil，下次追加时重试
+	closed   bool
+	appended int
+}
+
+// NewFileJobStore 打开（或创建）指定路径的任务日志
+func NewFileJobStore(path string, opts ...FileJobStoreOption) (*FileJobStore, error) {
+	s := &FileJobStore{path: path, compactEvery: 1000}
+	for _, o := range opts {
+		o(s)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.file = f
+	return s, nil
+}
+
+// Append 追加一条记录并落盘
+func (s *FileJobStore) Append(rec JobRecord) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return fmt.Errorf("job store closed")
+	}
+	if s.file == nil {
+		f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		s.file = f
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.appended++
+	if s.compactEvery > 0 && s.appended >= s.compactEvery {
+		return s.compactLocked()
+	}
+	return nil
+}
+
+// Load 读取日志并返回每个任务合并后的最新记录
+func (s *FileJobStore) Load() ([]JobRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.loadLocked()
+}
+
+func (s *FileJobStore) loadLocked() ([]JobRecord, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []JobRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var rec JobRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			// 崩溃时最后一行可能只写了一半，跳过损坏的行
+			continue
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mergeJobRecords(records), nil
+}
+
+// Compact 重写日志，只保留未结束任务的合并记录
+func (s *FileJobStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compactLocked()
+}
+
+func (s *FileJobStore) compactLocked() error {
+	records, err := s.loadLocked()
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, rec := range records {
+		if rec.State.IsTerminal() {
+			continue
+		}
+		if err := enc.Encode(rec); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	// 先替换再切换句柄：改名失败时旧日志及其句柄保持可用
+	if err := os.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	s.appended = 0
+	old := s.file
+	s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if old != nil {
+		// 旧句柄指向已被替换的文件，继续写入会丢失记录
+		old.Close()
+	}
+	if err != nil {
+		s.file = nil
+		return err
+	}
+	return nil
+}
+
+// Close 关闭日志文件
+func (s *FileJobStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
@@ -0,0 +1,204 @@
+package comfyui2go
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// promptTrack 记录一个 prompt 的执行进度，用于计算耗时指标和维护追踪 span
+type promptTrack struct {
+	submitted  time.Time // 提交请求发出的时间
+	started    time.Time // execution_start
+	classTypes map[string]string
+	node       string
+	nodeStart  time.Time
+
+	ctx      context.Context // 携带 prompt span 的 ctx，节点 span 以此为父
+	span     Span
+	nodeSpan Span
+}
+
+// promptTrackTTL 超过该时间仍未结束的记录会被清理（如未启用 WebSocket 时）
+const promptTrackTTL = 24 * time.Hour
+
+// tracksPrompts 设置了指标或追踪时才跟踪 prompt 的执行过程
+func (c *Client) tracksPrompts() bool {
+	return c.metrics != nil || c.tracer != nil
+}
+
+// trackPrompt 在提交成功后登记 prompt；执行事件可能先于提交响应到达，此时补算排队时间
+func (c *Client) trackPrompt(ctx context.Context, span Span, promptID string, workflow JSON, submitted time.Time) {
+	if !c.tracksPrompts() {
+		span.End(nil)
+		return
+	}
+	server := c.getBaseURL()
+	if c.metrics != nil {
+		c.metrics.PromptSubmitted(server)
+	}
+
+	classTypes := make(map[string]string, len(workflow))
+	for id, v := range workflow {
+		if node, ok := v.(map[string]interface{}); ok {
+			if ct, ok := node["class_type"].(string); ok {
+				classTypes[id] = ct
+			}
+		}
+	}
+
+	c.tracksMu.Lock()
+	defer c.tracksMu.Unlock()
+	if c.tracks == nil {
+		c.tracks = make(map[string]*promptTrack)
+	}
+	for id, t := range c.tracks {
+		if time.Since(t.submitted) > promptTrackTTL && time.Since(t.started) > promptTrackTTL {
+			t.endSpans(fmt.Errorf("prompt %s: no completion observed", id))
+			delete(c.tracks, id)
+		}
+	}
+	t, ok := c.tracks[promptID]
+	if !ok {
+		c.tracks[promptID] = &promptTrack{submitted: submitted, classTypes: classTypes, ctx: ctx, span: span}
+		return
+	}
+	t.submitted, t.classTypes, t.ctx, t.span = submitted, classTypes, ctx, span
+	if !t.started.IsZero() {
+		span.AddEvent("execution_start")
+		if c.metrics != nil {
+			c.metrics.QueueWait(server, t.started.Sub(submitted))
+		}
+	}
+}
+
+// endSpans 结束节点 span 与 prompt span
+func (t *promptTrack) endSpans(err error) {
+	if t.nodeSpan != nil {
+		t.nodeSpan.End(nil)
+		t.nodeSpan = nil
+	}
+	if t.span != nil {
+		t.span.End(err)
+		t.span = nil
+	}
+}
+
+// observeWSMessage 根据 WebSocket 事件更新指标与追踪
+func (c *Client) observeWSMessage(msg WSMessage) {
+	promptID, _ := msg.Data["prompt_id"].(string)
+	if promptID == "" {
+		return
+	}
+	server := c.getBaseURL()
+	now := time.Now()
+
+	c.tracksMu.Lock()
+	defer c.tracksMu.Unlock()
+	if c.tracks == nil {
+		c.tracks = make(map[string]*promptTrack)
+	}
+	t, ok := c.tracks[promptID]
+	if !ok {
+		if msg.Type != "execution_start" {
+			return
+		}
+		// 提交响应尚未返回，先登记
+		t = &promptTrack{}
+		c.tracks[promptID] = t
+	}
+
+	closeNode := func() {
+		if t.node == "" {
+			return
+		}
+		if c.metrics != nil {
+			c.metrics.NodeDuration(server, t.classTypes[t.node], now.Sub(t.nodeStart))
+		}
+		if t.nodeSpan != nil {
+			t.nodeSpan.End(nil)
+			t.nodeSpan = nil
+		}
+		t.node = ""
+	}
+	finish := func(status string, err error) {
+		closeNode()
+		if c.metrics != nil {
+			if status == "success" && !t.started.IsZero() {
+				c.metrics.ExecutionDuration(server, now.Sub(t.started))
+			}
+			c.metrics.PromptFinished(server, status)
+		}
+		if t.span != nil {
+			t.span.SetAttributes(Attr("comfyui.prompt.status", status))
+		}
+		t.endSpans(err)
+		delete(c.tracks, promptID)
+	}
+
+	switch msg.Type {
+	case "execution_start":
+		t.started = now
+		if t.span != nil {
+			t.span.AddEvent("execution_start")
+		}
+		if c.metrics != nil && !t.submitted.IsZero() {
+			c.metrics.QueueWait(server, now.Sub(t.submitted))
+		}
+	case "execution_cached":
+		if t.span != nil {
+			nodes, _ := msg.Data["nodes"].([]interface{})
+			t.span.AddEvent("execution_cached", Attr("comfyui.cached_nodes", len(nodes)))
+		}
+	case "executing":
+		closeNode()
+		node, _ := msg.Data["node"].(string)
+		if node == "" {
+			// 旧版本服务器没有 execution_success，以 node 为空表示执行完成
+			finish("success", nil)
+			return
+		}
+		t.node, t.nodeStart = node, now
+		if t.span != nil {
+			_, t.nodeSpan = c.tracing().Start(t.ctx, "comfyui.node",
+				Attr("comfyui.node.id", node),
+				Attr("comfyui.node.class_type", t.classTypes[node]),
+			)
+		}
+	case "execution_success":
+		finish("success", nil)
+	case "execution_error":
+		finish("error", executionErrorFrom(msg.Type, msg.Data))
+	case "execution_interrupted":
+		finish("interrupted", executionErrorFrom(msg.Type, msg.Data))
+	}
+}
+
+// observeHistory 在通过轮询得到最终状态时记录结束（WebSocket 已记录过的不会重复计数）
+func (c *Client) observeHistory(promptID string, item HistoryItem) {
+	if !c.tracksPrompts() {
+		return
+	}
+	c.tracksMu.Lock()
+	defer c.tracksMu.Unlock()
+	t, ok := c.tracks[promptID]
+	if !ok {
+		return
+	}
+	delete(c.tracks, promptID)
+	status := "success"
+	var err error
+	if failure := historyFailure(promptID, item); failure != nil {
+		status, err = "error", failure
+		if failure.Interrupted {
+			status = "interrupted"
+		}
+	}
+	if c.metrics != nil {
+		c.metrics.PromptFinished(c.getBaseURL(), status)
+	}
+	if t.span != nil {
+		t.span.SetAttributes(Attr("comfyui.prompt.status", status))
+	}
+	t.endSpans(err)
+}
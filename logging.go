@@ -0,0 +1,109 @@
+package comfyui2go
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	resty "resty.dev/v3"
+)
+
+// discardLogger 为未设置日志时使用的空日志
+var discardLogger = slog.New(slog.DiscardHandler)
+
+// WithLogger 设置结构化日志。HTTP 请求（路径、状态码、耗时）、提交的 prompt ID、
+// WebSocket 连接与重连、被丢弃的消息等都会以合适的级别输出；认证相关的请求头会被脱敏。
+// 默认不输出任何日志。
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) { c.logger = logger }
+}
+
+// log 返回客户端日志，未设置时返回空日志
+func (c *Client) log() *slog.Logger {
+	if c.logger == nil {
+		return discardLogger
+	}
+	return c.logger
+}
+
+// installLogging 在 HTTP 请求链上记录每个请求的结果
+func (c *Client) installLogging() {
+	logger := c.log()
+	c.cli.AddResponseMiddleware(func(_ *resty.Client, r *resty.Response) error {
+		ctx := r.Request.Context()
+		level := slog.LevelDebug
+		switch {
+		case r.StatusCode() >= 500:
+			level = slog.LevelError
+		case r.StatusCode() >= 400:
+			level = slog.LevelWarn
+		}
+		if !logger.Enabled(ctx, level) {
+			return nil
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Request.Method),
+			slog.String("path", requestPath(r.Request)),
+			slog.Int("status", r.StatusCode()),
+			slog.Duration("latency", r.Duration()),
+		}
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, slog.Any("headers", redactHeaders(r.Request.Header)))
+		}
+		logger.LogAttrs(ctx, level, "comfyui http request", attrs...)
+		return nil
+	})
+	c.cli.OnError(func(req *resty.Request, err error) {
+		logger.LogAttrs(req.Context(), slog.LevelError, "comfyui http request failed",
+			slog.String("method", req.Method),
+			slog.String("path", requestPath(req)),
+			slog.Any("error", err),
+		)
+	})
+}
+
+// requestPath 返回请求路径（不含查询参数）
+func requestPath(req *resty.Request) string {
+	if req.RawRequest != nil {
+		return req.RawRequest.URL.Path
+	}
+	if u, err := url.Parse(req.URL); err == nil {
+		return u.Path
+	}
+	return req.URL
+}
+
+// sensitiveHeaderTokens 头名中包含这些片段时值会被脱敏
+var sensitiveHeaderTokens = []string{"authorization", "cookie", "token", "secret", "password", "api-key", "apikey"}
+
+// redactHeaders 复制请求头并隐藏认证信息
+func redactHeaders(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		lower := strings.ToLower(k)
+		redacted := false
+		for _, t := range sensitiveHeaderTokens {
+			if strings.Contains(lower, t) {
+				redacted = true
+				break
+			}
+		}
+		if redacted {
+			out[k] = "[REDACTED]"
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// wsLogURL 返回去掉用户信息的 WebSocket 地址，用于日志
+func wsLogURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,119 @@
+package comfyui2go
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// LogEntry 为一条服务器日志。
+type LogEntry struct {
+	// Time 为服务器写入的时间戳字符串（ISO 8601）
+	Time string `json:"t"`
+	// Message 为日志内容，通常以换行结尾；traceback 可能跨越多条
+	Message string `json:"m"`
+}
+
+// TerminalSize 为服务器终端尺寸
+type TerminalSize struct {
+	Cols int `json:"cols"`
+	Rows int `json:"rows"`
+}
+
+// Logs 对应 GET /internal/logs/raw 以及 WebSocket 的 "logs" 消息。
+type Logs struct {
+	Entries []LogEntry   `json:"entries"`
+	Size    TerminalSize `json:"size"`
+}
+
+// GetLogs 调用 GET /internal/logs 返回服务器最近日志拼接后的文本（每行形如 "时间 - 内容"）。
+// /internal/* 路由不在 /api 命名空间下，本文件的请求都使用不含 /api 的绝对地址。
+func (c *Client) GetLogs(ctx context.Context) (string, error) {
+	var out string
+	r, err := c.cli.R().SetContext(ctx).SetResult(&out).Get(c.rootURL() + "/internal/logs")
+	if err != nil {
+		return "", err
+	}
+	if !r.IsSuccess() {
+		return "", fmt.Errorf("/internal/logs failed: %s", r.String())
+	}
+	return out, nil
+}
+
+// GetRawLogs 调用 GET /internal/logs/raw 返回带时间戳的日志条目。
+func (c *Client) GetRawLogs(ctx context.Context) (*Logs, error) {
+	var out Logs
+	r, err := c.cli.R().SetContext(ctx).SetResult(&out).Get(c.rootURL() + "/internal/logs/raw")
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("/internal/logs/raw failed: %s", r.String())
+	}
+	return &out, nil
+}
+
+// setLogsSubscription 调用 PATCH /internal/logs/subscribe 开启或关闭当前 WebSocket 连接的日志推送
+func (c *Client) setLogsSubscription(ctx context.Context, enabled bool) error {
+	r, err := c.cli.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(JSON{"clientId": c.clientID, "enabled": enabled}).
+		Patch(c.rootURL() + "/internal/logs/subscribe")
+	if err != nil {
+		return err
+	}
+	if !r.IsSuccess() {
+		return fmt.Errorf("/internal/logs/subscribe failed: %s", r.String())
+	}
+	return nil
+}
+
+// SubscribeLogs 通过 WebSocket 订阅服务器实时日志，每收到一批新日志调用一次 fn。
+// 需要启用 WebSocket；服务器按 clientId 推送，因此同一客户端的多个订阅共享一次服务器端订阅。
+// 返回的 unsubscribe 移除本订阅，最后一个订阅移除时通知服务器停止推送。
+func (c *Client) SubscribeLogs(ctx context.Context, fn func(entries []LogEntry)) (unsubscribe func(), err error) {
+	if err := c.ensureWebSocketConnected(ctx); err != nil {
+		return nil, err
+	}
+
+	remove := c.addWSListener(func(msg WSMessage) {
+		if msg.Type != "logs" {
+			return
+		}
+		data, err := json.Marshal(msg.Data)
+		if err != nil {
+			return
+		}
+		var logs Logs
+		if err := json.Unmarshal(data, &logs); err != nil || len(logs.Entries) == 0 {
+			return
+		}
+		fn(logs.Entries)
+	})
+
+	c.logsMu.Lock()
+	defer c.logsMu.Unlock()
+	if c.logSubs == 0 {
+		if err := c.setLogsSubscription(ctx, true); err != nil {
+			remove()
+			return nil, err
+		}
+	}
+	c.logSubs++
+
+	var done bool
+	return func() {
+		c.logsMu.Lock()
+		defer c.logsMu.Unlock()
+		if done {
+			return
+		}
+		done = true
+		remove()
+		c.logSubs--
+		if c.logSubs == 0 {
+			_ = c.setLogsSubscription(context.Background(), false)
+		}
+	}, nil
+}
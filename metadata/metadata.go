@@ -0,0 +1,352 @@
+// Package metadata 读写 ComfyUI 嵌入在输出图片中的工作流元数据。
+//
+// ComfyUI 的 SaveImage 将 API 格式的 "prompt" 和界面格式的 "workflow" 以 JSON 写入 PNG 的 tEXt 块；
+// SaveAnimatedWEBP 则写入 EXIF IFD0 的 ASCII 标签（0x0110、0x010F...），值形如 "prompt:{...}"。
+// 本包从下载的字节中提取这些信息以复现任意输出，也可向待上传的 PNG 注入自定义元数据。
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// ErrUnsupportedFormat 表示既不是 PNG 也不是 WebP。
+var ErrUnsupportedFormat = errors.New("unsupported image format")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Metadata 为图片中的文本元数据。
+type Metadata struct {
+	// Prompt 为 API 格式的工作流，可直接传给 Client.Prompt 复现结果
+	Prompt comfyui2go.JSON
+	// Workflow 为界面格式的工作流（节点位置、连线等）
+	Workflow comfyui2go.JSON
+	// Text 为全部原始文本条目（包括 prompt 和 workflow）
+	Text map[string]string
+}
+
+// Read 从 PNG 或 WebP 字节中读取元数据。
+func Read(data []byte) (*Metadata, error) {
+	var text map[string]string
+	var err error
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		text, err = readPNGText(data)
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		text, err = readWebPText(data)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	md := &Metadata{Text: text}
+	if s, ok := text["prompt"]; ok {
+		if err := json.Unmarshal([]byte(s), &md.Prompt); err != nil {
+			return nil, fmt.Errorf("parse prompt: %w", err)
+		}
+	}
+	if s, ok := text["workflow"]; ok {
+		if err := json.Unmarshal([]byte(s), &md.Workflow); err != nil {
+			return nil, fmt.Errorf("parse workflow: %w", err)
+		}
+	}
+	return md, nil
+}
+
+// pngChunk 是 PNG 中的一个数据块
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+// readPNGChunks 拆分 PNG 数据块，不校验 CRC
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrUnsupportedFormat
+	}
+	var chunks []pngChunk
+	pos := len(pngSignature)
+	for pos+8 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[pos:]))
+		typ := string(data[pos+4 : pos+8])
+		if n < 0 || pos+12+n > len(data) {
+			return nil, fmt.Errorf("truncated png chunk %q", typ)
+		}
+		chunks = append(chunks, pngChunk{typ: typ, data: data[pos+8 : pos+8+n]})
+		pos += 12 + n
+		if typ == "IEND" {
+			break
+		}
+	}
+	return chunks, nil
+}
+
+// readPNGText 读取 tEXt、zTXt 和 iTXt 块
+func readPNGText(data []byte) (map[string]string, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	text := make(map[string]string)
+	for _, c := range chunks {
+		var key, value string
+		var err error
+		switch c.typ {
+		case "tEXt":
+			key, value, err = parseTEXt(c.data)
+		case "zTXt":
+			key, value, err = parseZTXt(c.data)
+		case "iTXt":
+			key, value, err = parseITXt(c.data)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s chunk: %w", c.typ, err)
+		}
+		text[key] = value
+	}
+	return text, nil
+}
+
+func parseTEXt(data []byte) (string, string, error) {
+	key, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", "", errors.New("missing keyword separator")
+	}
+	return string(key), latin1(rest), nil
+}
+
+func parseZTXt(data []byte) (string, string, error) {
+	key, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || len(rest) < 1 {
+		return "", "", errors.New("missing keyword separator")
+	}
+	raw, err := inflate(rest[1:])
+	if err != nil {
+		return "", "", err
+	}
+	return string(key), latin1(raw), nil
+}
+
+func parseITXt(data []byte) (string, string, error) {
+	key, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || len(rest) < 2 {
+		return "", "", errors.New("missing keyword separator")
+	}
+	compressed := rest[0] == 1
+	rest = rest[2:]
+	// 跳过语言标签和翻译后的关键字
+	for i := 0; i < 2; i++ {
+		_, after, ok := bytes.Cut(rest, []byte{0})
+		if !ok {
+			return "", "", errors.New("malformed iTXt header")
+		}
+		rest = after
+	}
+	if compressed {
+		raw, err := inflate(rest)
+		if err != nil {
+			return "", "", err
+		}
+		rest = raw
+	}
+	return string(key), string(rest), nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// latin1 将 ISO-8859-1 文本转为 UTF-8；ComfyUI 实际写入的是 UTF-8，此时原样返回
+func latin1(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// readWebPText 从 WebP 的 EXIF 块中读取 "key:value" 形式的 ASCII 标签
+func readWebPText(data []byte) (map[string]string, error) {
+	text := make(map[string]string)
+	pos := 12
+	for pos+8 <= len(data) {
+		fourcc := string(data[pos : pos+4])
+		n := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if n < 0 || pos+8+n > len(data) {
+			return nil, fmt.Errorf("truncated webp chunk %q", fourcc)
+		}
+		if fourcc == "EXIF" {
+			exif := bytes.TrimPrefix(data[pos+8:pos+8+n], []byte("Exif\x00\x00"))
+			for _, s := range exifASCII(exif) {
+				if key, value, ok := strings.Cut(s, ":"); ok {
+					text[key] = value
+				}
+			}
+		}
+		// 块按偶数字节对齐
+		pos += 8 + n + n%2
+	}
+	return text, nil
+}
+
+// exifASCII 返回 IFD0 中全部 ASCII 类型标签的值
+func exifASCII(tiff []byte) []string {
+	if len(tiff) < 8 {
+		return nil
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return nil
+	}
+	var out []string
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry+2:]) != 2 { // ASCII
+			continue
+		}
+		n := int(order.Uint32(tiff[entry+4:]))
+		var value []byte
+		if n <= 4 {
+			value = tiff[entry+8 : entry+8+n]
+		} else {
+			off := int(order.Uint32(tiff[entry+8:]))
+			if off < 0 || off+n > len(tiff) {
+				continue
+			}
+			value = tiff[off : off+n]
+		}
+		out = append(out, string(bytes.TrimRight(value, "\x00")))
+	}
+	return out
+}
+
+// WritePNG 向 PNG 注入文本元数据，返回新的字节。
+// 同名的已有 tEXt/zTXt/iTXt 条目会被替换；纯 ASCII 的值以 tEXt 写入（与 ComfyUI 一致），
+// 其余以未压缩的 iTXt（UTF-8）写入。
+func WritePNG(data []byte, text map[string]string) ([]byte, error) {
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) == 0 || chunks[0].typ != "IHDR" {
+		return nil, errors.New("png missing IHDR")
+	}
+
+	keys := make([]string, 0, len(text))
+	for k := range text {
+		if k == "" || len(k) > 79 || strings.ContainsRune(k, 0) {
+			return nil, fmt.Errorf("invalid png text keyword %q", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	for i, c := range chunks {
+		if c.typ == "tEXt" || c.typ == "zTXt" || c.typ == "iTXt" {
+			key, _, _ := bytes.Cut(c.data, []byte{0})
+			if _, replaced := text[string(key)]; replaced {
+				continue
+			}
+		}
+		writePNGChunk(&buf, c.typ, c.data)
+		if i == 0 {
+			// 文本块紧跟在 IHDR 之后
+			for _, k := range keys {
+				var body bytes.Buffer
+				body.WriteString(k)
+				if isASCII(text[k]) {
+					body.WriteByte(0)
+					body.WriteString(text[k])
+					writePNGChunk(&buf, "tEXt", body.Bytes())
+					continue
+				}
+				body.Write([]byte{0, 0, 0, 0, 0}) // 分隔符、未压缩、压缩方法、空语言标签、空翻译关键字
+				body.WriteString(text[k])
+				writePNGChunk(&buf, "iTXt", body.Bytes())
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteWorkflowPNG 将 prompt 和 workflow 以 ComfyUI 的格式写入 PNG，nil 值会被跳过
+func WriteWorkflowPNG(data []byte, prompt, workflow comfyui2go.JSON) ([]byte, error) {
+	text := make(map[string]string)
+	if prompt != nil {
+		b, err := json.Marshal(prompt)
+		if err != nil {
+			return nil, err
+		}
+		text["prompt"] = string(b)
+	}
+	if workflow != nil {
+		b, err := json.Marshal(workflow)
+		if err != nil {
+			return nil, err
+		}
+		text["workflow"] = string(b)
+	}
+	return WritePNG(data, text)
+}
+
+func writePNGChunk(w *bytes.Buffer, typ string, data []byte) {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[:4], uint32(len(data)))
+	copy(hdr[4:], typ)
+	w.Write(hdr[:])
+	w.Write(data)
+
+	crc := crc32.NewIEEE()
+	crc.Write(hdr[4:])
+	crc.Write(data)
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc.Sum32())
+	w.Write(sum[:])
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
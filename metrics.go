@@ -0,0 +1,249 @@
+package comfyui2go
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics 接收客户端的运行指标，实现需并发安全。server 为服务器地址（baseURL），用于区分多台服务器。
+// 执行相关的指标（排队时间、执行时间、节点耗时）来自 WebSocket 事件，需启用 WebSocket。
+type Metrics interface {
+	// PromptSubmitted 成功提交一个 prompt
+	PromptSubmitted(server string)
+	// PromptFinished prompt 结束，status 为 "success"、"error" 或 "interrupted"
+	PromptFinished(server, status string)
+	// QueueWait 从提交到开始执行（execution_start）的等待时间
+	QueueWait(server string, d time.Duration)
+	// ExecutionDuration 从开始执行到成功结束的时间
+	ExecutionDuration(server string, d time.Duration)
+	// NodeDuration 单个节点的执行时间，classType 未知时为空
+	NodeDuration(server, classType string, d time.Duration)
+	// QueueDepth 调用 GetQueue 时观察到的运行中与等待中的任务数
+	QueueDepth(server string, running, pending int)
+	// DownloadBytes 通过 Download 下载的字节数
+	DownloadBytes(server string, n int)
+	// WSReconnect WebSocket 重新连接
+	WSReconnect(server string)
+}
+
+// WithMetrics 设置指标接收者。
+func WithMetrics(m Metrics) Option {
+	return func(c *Client) { c.metrics = m }
+}
+
+// DefaultDurationBuckets 为耗时直方图的默认分桶（秒）
+var DefaultDurationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// PrometheusMetrics 是不依赖第三方库的 Metrics 实现，
+// 同时是一个 http.Handler，以 Prometheus 文本格式输出全部指标。
+type PrometheusMetrics struct {
+	namespace string
+	buckets   []float64
+
+	mu       sync.Mutex
+	families map[string]*promFamily
+}
+
+// promFamily 为同名的一组时间序列
+type promFamily struct {
+	name, help, typ string
+	labels          []string
+	series          map[string]*promSeries
+}
+
+// promSeries 为一条时间序列；直方图使用 counts/sum/count
+type promSeries struct {
+	labelValues []string
+	value       float64
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// NewPrometheusMetrics 创建 Prometheus 指标，指标名以 namespace 为前缀（为空时使用 "comfyui"），
+// buckets 为耗时直方图分桶（秒，为空时使用 DefaultDurationBuckets）。
+func NewPrometheusMetrics(namespace string, buckets []float64) *PrometheusMetrics {
+	if namespace == "" {
+		namespace = "comfyui"
+	}
+	if len(buckets) == 0 {
+		buckets = DefaultDurationBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &PrometheusMetrics{namespace: namespace, buckets: sorted, families: make(map[string]*promFamily)}
+}
+
+// series 返回（必要时创建）指定指标的时间序列，调用方需持有 p.mu
+func (p *PrometheusMetrics) series(name, help, typ string, labels []string, values ...string) *promSeries {
+	f, ok := p.families[name]
+	if !ok {
+		f = &promFamily{name: p.namespace + "_" + name, help: help, typ: typ, labels: labels, series: make(map[string]*promSeries)}
+		p.families[name] = f
+	}
+	key := strings.Join(values, "\xff")
+	s, ok := f.series[key]
+	if !ok {
+		s = &promSeries{labelValues: values}
+		if typ == "histogram" {
+			s.counts = make([]uint64, len(p.buckets))
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (p *PrometheusMetrics) add(name, help string, labels []string, delta float64, values ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series(name, help, "counter", labels, values...).value += delta
+}
+
+func (p *PrometheusMetrics) set(name, help string, labels []string, v float64, values ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.series(name, help, "gauge", labels, values...).value = v
+}
+
+func (p *PrometheusMetrics) observe(name, help string, labels []string, d time.Duration, values ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.series(name, help, "histogram", labels, values...)
+	v := d.Seconds()
+	for i, b := range p.buckets {
+		if v <= b {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+var serverLabel = []string{"server"}
+
+// PromptSubmitted 实现 Metrics
+func (p *PrometheusMetrics) PromptSubmitted(server string) {
+	p.add("prompts_submitted_total", "Prompts submitted to the server.", serverLabel, 1, server)
+}
+
+// PromptFinished 实现 Metrics
+func (p *PrometheusMetrics) PromptFinished(server, status string) {
+	p.add("prompts_finished_total", "Prompts finished, by final status.", []string{"server", "status"}, 1, server, status)
+}
+
+// QueueWait 实现 Metrics
+func (p *PrometheusMetrics) QueueWait(server string, d time.Duration) {
+	p.observe("prompt_queue_wait_seconds", "Time from submission to execution start.", serverLabel, d, server)
+}
+
+// ExecutionDuration 实现 Metrics
+func (p *PrometheusMetrics) ExecutionDuration(server string, d time.Duration) {
+	p.observe("prompt_execution_seconds", "Time from execution start to successful completion.", serverLabel, d, server)
+}
+
+// NodeDuration 实现 Metrics
+func (p *PrometheusMetrics) NodeDuration(server, classType string, d time.Duration) {
+	if classType == "" {
+		classType = "unknown"
+	}
+	p.observe("node_execution_seconds", "Execution time of a single node.", []string{"server", "class_type"}, d, server, classType)
+}
+
+// QueueDepth 实现 Metrics
+func (p *PrometheusMetrics) QueueDepth(server string, running, pending int) {
+	labels := []string{"server", "state"}
+	p.set("queue_depth", "Prompts in the server queue as last observed.", labels, float64(running), server, "running")
+	p.set("queue_depth", "Prompts in the server queue as last observed.", labels, float64(pending), server, "pending")
+}
+
+// DownloadBytes 实现 Metrics
+func (p *PrometheusMetrics) DownloadBytes(server string, n int) {
+	p.add("download_bytes_total", "Bytes downloaded from /view.", serverLabel, float64(n), server)
+}
+
+// WSReconnect 实现 Metrics
+func (p *PrometheusMetrics) WSReconnect(server string) {
+	p.add("websocket_reconnects_total", "WebSocket reconnections.", serverLabel, 1, server)
+}
+
+// ServeHTTP 以 Prometheus 文本格式（text/plain; version=0.0.4）输出指标
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write([]byte(p.Render()))
+}
+
+// Render 返回 Prometheus 文本格式的全部指标，按名称和标签排序
+func (p *PrometheusMetrics) Render() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		f := p.families[name]
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			s := f.series[key]
+			labels := formatLabels(f.labels, s.labelValues)
+			if f.typ != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, wrapLabels(labels), formatFloat(s.value))
+				continue
+			}
+			for i, bound := range p.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, wrapLabels(appendLabel(labels, "le", formatFloat(bound))), s.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, wrapLabels(appendLabel(labels, "le", "+Inf")), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, wrapLabels(labels), formatFloat(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, wrapLabels(labels), s.count)
+		}
+	}
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names, values []string) string {
+	parts := make([]string, len(names))
+	for i, n := range names {
+		parts[i] = n + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return strings.Join(parts, ",")
+}
+
+func appendLabel(labels, name, value string) string {
+	l := name + `="` + value + `"`
+	if labels == "" {
+		return l
+	}
+	return labels + "," + l
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,74 @@
+package comfyui2go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// ErrModelFolderNotFound 表示服务器没有该模型目录（如旧版本服务器使用不同的目录名）。
+var ErrModelFolderNotFound = errors.New("model folder not found")
+
+// GetModels 调用 GET /models/{folder} 返回指定模型目录下的文件名列表。
+// folder 如 "checkpoints"、"loras"、"vae"、"diffusion_models" 等；服务器没有该目录时返回 ErrModelFolderNotFound。
+func (c *Client) GetModels(ctx context.Context, folder string) ([]string, error) {
+	var out []string
+	path := "/models/" + url.PathEscape(folder)
+	r, err := c.cli.R().SetContext(ctx).SetResult(&out).Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode() == http.StatusNotFound {
+		return nil, fmt.Errorf("GET %s: %w", path, ErrModelFolderNotFound)
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("GET %s failed: %s", path, r.String())
+	}
+	return out, nil
+}
+
+// GetModelFolders 调用 GET /models 返回服务器上可用的模型目录名称列表。
+func (c *Client) GetModelFolders(ctx context.Context) ([]string, error) {
+	var out []string
+	r, err := c.cli.R().SetContext(ctx).SetResult(&out).Get("/models")
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("/models failed: %s", r.String())
+	}
+	return out, nil
+}
+
+// GetEmbeddings 调用 GET /embeddings 返回文本嵌入（textual inversion）名称列表，不含扩展名。
+func (c *Client) GetEmbeddings(ctx context.Context) ([]string, error) {
+	var out []string
+	r, err := c.cli.R().SetContext(ctx).SetResult(&out).Get("/embeddings")
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("/embeddings failed: %s", r.String())
+	}
+	return out, nil
+}
+
+// GetModelMetadata 调用 GET /view_metadata/{folder}?filename= 读取 safetensors 文件头中的
+// __metadata__ 字段（训练参数、基础模型等）。文件不存在或不含元数据时服务器返回 404。
+func (c *Client) GetModelMetadata(ctx context.Context, folder, filename string) (JSON, error) {
+	var out JSON
+	path := "/view_metadata/" + url.PathEscape(folder)
+	r, err := c.cli.R().SetContext(ctx).
+		SetQueryParam("filename", filename).
+		SetResult(&out).
+		Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("GET %s failed: %s", path, r.String())
+	}
+	return out, nil
+}
@@ -1,6 +1,7 @@
 package comfyui2go
 
 import (
+	"strings"
 	"time"
 
 	resty "resty.dev/v3"
@@ -33,12 +34,33 @@ func WithBaseURL(url string) Option {
 	}
 }
 
-// WithBasicAuth 为所有请求设置 HTTP 基本认证。
+// WithPathPrefix 设置反向代理下的路径前缀（如 "/comfy"），同时作用于 HTTP 请求和 WebSocket 连接。
+// 也可以直接在 baseURL 中包含路径（如 "https://gpu.example.com/comfy/"），两者会拼接。
+func WithPathPrefix(prefix string) Option {
+	return func(c *Client) {
+		prefix = strings.Trim(prefix, "/")
+		if prefix != "" {
+			prefix = "/" + prefix
+		}
+		c.pathPrefix = prefix
+	}
+}
+
+// WithAPIPrefix 使用 /api 命名空间访问 ComfyUI 路由（如 /api/prompt、/api/ws），
+// 适用于只转发 /api/* 的反向代理。/internal/* 路由不在该命名空间下，不受影响。
+// 未设置时按服务器能力探测结果自动选择（见 Probe）；显式设置后不再自动切换。
+func WithAPIPrefix(enable bool) Option {
+	return func(c *Client) {
+		c.apiPrefix = enable
+		c.apiPrefixSet = true
+	}
+}
+
+// WithBasicAuth 为所有请求（包括 WebSocket 握手）设置 HTTP 基本认证，
+// 等同于 WithAuthenticator(BasicAuth(user, pass))。
 func WithBasicAuth(user, pass string) Option {
 	return func(c *Client) {
-		c.cli.SetBasicAuth(user, pass)
-		c.username = user
-		c.password = pass
+		c.auth = BasicAuth(user, pass)
 	}
 }
 
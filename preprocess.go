@@ -0,0 +1,298 @@
+package comfyui2go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // 注册 GIF 解码器
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// PreprocessOptions 上传前的图片预处理选项，仅使用标准库实现。
+type PreprocessOptions struct {
+	// NormalizeOrientation 按 JPEG EXIF 方向标记旋转/翻转像素（手机照片常见）
+	NormalizeOrientation bool
+	// MaxDimension 限制最长边像素数，超出时等比缩小（<=0 表示不限制）
+	MaxDimension int
+	// AlignTo 将宽高向下对齐到该值的整数倍（如 8 或 64，<=1 表示不对齐），对齐时会轻微缩放
+	AlignTo int
+	// ConvertToPNG 总是输出 PNG；否则仅在像素被修改时按原格式重新编码（GIF 输出为 PNG）
+	ConvertToPNG bool
+	// ExtractMask 从 alpha 通道提取局部重绘蒙版（透明处为白色），结果放在 PreprocessedImage.Mask。
+	// 只用于 PreprocessImage；WithPreprocess 不支持该选项，会返回错误
+	ExtractMask bool
+}
+
+// PreprocessedImage 预处理结果
+type PreprocessedImage struct {
+	Filename string
+	Data     []byte
+	Width    int
+	Height   int
+	// Mask 为 PNG 编码的蒙版，可直接用 UploadMask 上传：alpha 通道保留原图的透明度（/upload/mask 只读取 alpha），
+	// RGB 为蒙版值（透明处为白色），也可作为图片上传供 LoadImageMask 使用。未要求提取或图片不含透明像素时为 nil
+	Mask []byte
+}
+
+// WithPreprocess 在上传前对图片执行预处理（与 WithUploadDedup 配合时按处理后的内容计算哈希）。
+// 需要蒙版时请直接调用 PreprocessImage，再分别上传图片和蒙版。
+func WithPreprocess(opts PreprocessOptions) UploadOption {
+	return func(o *uploadOptions) { o.preprocess = &opts }
+}
+
+// PreprocessImage 按选项处理图片。filename 用于判断原格式并生成输出文件名。
+func PreprocessImage(r io.Reader, filename string, opts PreprocessOptions) (*PreprocessedImage, error) {
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	img, format, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	changed := false
+	if opts.NormalizeOrientation && format == "jpeg" {
+		if o := jpegOrientation(raw); o > 1 && o <= 8 {
+			img = applyOrientation(img, o)
+			changed = true
+		}
+	}
+
+	b := img.Bounds()
+	w, h := targetSize(b.Dx(), b.Dy(), opts.MaxDimension, opts.AlignTo)
+	if w != b.Dx() || h != b.Dy() {
+		img = resizeBox(img, w, h)
+		changed = true
+	}
+
+	out := &PreprocessedImage{
+		Filename: filename,
+		Data:     raw,
+		Width:    img.Bounds().Dx(),
+		Height:   img.Bounds().Dy(),
+	}
+
+	if opts.ExtractMask {
+		if mask := ExtractAlphaMask(img); mask != nil {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, maskImage(mask)); err != nil {
+				return nil, err
+			}
+			out.Mask = buf.Bytes()
+		}
+	}
+
+	toPNG := opts.ConvertToPNG || format == "gif"
+	if !changed && (!toPNG || format == "png") {
+		return out, nil
+	}
+
+	var buf bytes.Buffer
+	if toPNG || format != "jpeg" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		out.Filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".png"
+	} else {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+			return nil, err
+		}
+	}
+	out.Data = buf.Bytes()
+	return out, nil
+}
+
+// ExtractAlphaMask 从 alpha 通道生成蒙版：完全透明为 255（需要重绘），完全不透明为 0，
+// 与 ComfyUI LoadImage 输出的 MASK 约定一致。图片不含透明像素时返回 nil。
+func ExtractAlphaMask(img image.Image) *image.Gray {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return nil
+	}
+	b := img.Bounds()
+	mask := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	hasAlpha := false
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			v := 255 - uint8(a>>8)
+			if v != 0 {
+				hasAlpha = true
+			}
+			mask.SetGray(x-b.Min.X, y-b.Min.Y, color.Gray{Y: v})
+		}
+	}
+	if !hasAlpha {
+		return nil
+	}
+	return mask
+}
+
+// maskImage 将蒙版转为带 alpha 的图片：RGB 为蒙版值，alpha 为 255 减蒙版值。
+// ComfyUI 以 1 - alpha 作为 MASK，因此按 alpha 或颜色通道读取得到的蒙版相同。
+func maskImage(mask *image.Gray) *image.NRGBA {
+	out := image.NewNRGBA(mask.Bounds())
+	for i, v := range mask.Pix {
+		out.Pix[4*i] = v
+		out.Pix[4*i+1] = v
+		out.Pix[4*i+2] = v
+		out.Pix[4*i+3] = 255 - v
+	}
+	return out
+}
+
+// targetSize 计算限制最长边并对齐后的尺寸
+func targetSize(w, h, maxDim, align int) (int, int) {
+	if maxDim > 0 && (w > maxDim || h > maxDim) {
+		if w >= h {
+			h = max(1, h*maxDim/w)
+			w = maxDim
+		} else {
+			w = max(1, w*maxDim/h)
+			h = maxDim
+		}
+	}
+	if align > 1 {
+		w = max(align, w-w%align)
+		h = max(align, h-h%align)
+	}
+	return w, h
+}
+
+// resizeBox 使用区域平均（box filter）缩放，在预乘 alpha 空间计算以避免透明边缘发灰
+func resizeBox(src image.Image, w, h int) image.Image {
+	sb := src.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, sb.Dx(), sb.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, sb.Min, draw.Src)
+
+	sw, sh := sb.Dx(), sb.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for dy := 0; dy < h; dy++ {
+		y0 := dy * sh / h
+		y1 := max(y0+1, (dy+1)*sh/h)
+		for dx := 0; dx < w; dx++ {
+			x0 := dx * sw / w
+			x1 := max(x0+1, (dx+1)*sw/w)
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				off := rgba.PixOffset(x0, y)
+				for x := x0; x < x1; x++ {
+					r += uint64(rgba.Pix[off])
+					g += uint64(rgba.Pix[off+1])
+					b += uint64(rgba.Pix[off+2])
+					a += uint64(rgba.Pix[off+3])
+					off += 4
+					n++
+				}
+			}
+			off := dst.PixOffset(dx, dy)
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(b / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+// applyOrientation 按 EXIF 方向值（2-8）变换图片
+func applyOrientation(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 旋转 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿主对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转 90°
+				dx, dy = h-1-y, x
+			case 7: // 沿副对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针旋转 90°
+				dx, dy = y, w-1-x
+			default:
+				dx, dy = x, y
+			}
+			dst.Set(dx, dy, src.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation 从 JPEG 的 APP1 Exif 段读取方向标记（0x0112），未找到时返回 0
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0
+	}
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return 0
+		}
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 { // 图像数据开始或结束
+			return 0
+		}
+		size := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if size < 2 || pos+2+size > len(data) {
+			return 0
+		}
+		segment := data[pos+4 : pos+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + size
+	}
+	return 0
+}
+
+// exifOrientation 解析 TIFF 结构中 IFD0 的方向标记
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 0
+}
@@ -0,0 +1,429 @@
+package comfyui2go
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoEligibleServer 表示没有任何服务器同时具备工作流所需的节点和模型。
+var ErrNoEligibleServer = errors.New("no eligible server")
+
+// DefaultModelInputFolders 为节点输入名到模型目录（/models/{folder}）的默认映射。
+// 键可以是 "输入名" 或 "class_type.输入名"，后者优先，用于区分同名输入（如 CLIPVisionLoader 的 clip_name）。
+var DefaultModelInputFolders = map[string]string{
+	"ckpt_name":                              "checkpoints",
+	"unet_name":                              "diffusion_models",
+	"vae_name":                               "vae",
+	"lora_name":                              "loras",
+	"clip_name":                              "text_encoders",
+	"clip_name1":                             "text_encoders",
+	"clip_name2":                             "text_encoders",
+	"clip_name3":                             "text_encoders",
+	"control_net_name":                       "controlnet",
+	"style_model_name":                       "style_models",
+	"gligen_name":                            "gligen",
+	"hypernetwork_name":                      "hypernetworks",
+	"CLIPVisionLoader.clip_name":             "clip_vision",
+	"UpscaleModelLoader.model_name":          "upscale_models",
+	"PhotoMakerLoader.photomaker_model_name": "photomaker",
+}
+
+// ModelFolderAliases 为模型目录的旧名称。Router 检查某目录时同时查看其旧名称，
+// 模型出现在任一目录中即视为存在（如旧版本服务器把文本编码器放在 clip 目录下）。
+var ModelFolderAliases = map[string][]string{
+	"text_encoders":    {"clip"},
+	"diffusion_models": {"unet"},
+}
+
+// Requirements 描述一个工作流运行所需的节点类型与模型文件。
+type Requirements struct {
+	// ClassTypes 为工作流使用的全部节点 class_type（已排序去重）。
+	ClassTypes []string
+	// Models 为 模型目录 -> 文件名列表（已排序去重）。
+	Models map[string][]string
+}
+
+// IsEmpty 判断是否没有任何要求。
+func (r Requirements) IsEmpty() bool {
+	return len(r.ClassTypes) == 0 && len(r.Models) == 0
+}
+
+// String 以便于阅读的形式输出要求内容。
+func (r Requirements) String() string {
+	var parts []string
+	if len(r.ClassTypes) > 0 {
+		parts = append(parts, "nodes="+strings.Join(r.ClassTypes, ","))
+	}
+	folders := make([]string, 0, len(r.Models))
+	for f := range r.Models {
+		folders = append(folders, f)
+	}
+	sort.Strings(folders)
+	for _, f := range folders {
+		parts = append(parts, f+"="+strings.Join(r.Models[f], ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+// WorkflowRequirements 使用默认映射分析工作流所需的节点类型和模型文件。
+func WorkflowRequirements(workflow JSON) Requirements {
+	return workflowRequirements(workflow, DefaultModelInputFolders)
+}
+
+func workflowRequirements(workflow JSON, folders map[string]string) Requirements {
+	classes := map[string]struct{}{}
+	models := map[string]map[string]struct{}{}
+
+	for _, v := range workflow {
+		node, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		classType, _ := node["class_type"].(string)
+		if classType == "" {
+			continue
+		}
+		classes[classType] = struct{}{}
+
+		inputs, _ := node["inputs"].(map[string]interface{})
+		for name, value := range inputs {
+			// 只有字符串值才是文件名，数组表示节点连接
+			filename, ok := value.(string)
+			if !ok || filename == "" {
+				continue
+			}
+			folder, ok := folders[classType+"."+name]
+			if !ok {
+				folder, ok = folders[name]
+			}
+			if !ok || folder == "" {
+				continue
+			}
+			if models[folder] == nil {
+				models[folder] = map[string]struct{}{}
+			}
+			models[folder][filename] = struct{}{}
+		}
+	}
+
+	req := Requirements{ClassTypes: sortedKeys(classes)}
+	if len(models) > 0 {
+		req.Models = make(map[string][]string, len(models))
+		for folder, set := range models {
+			req.Models[folder] = sortedKeys(set)
+		}
+	}
+	return req
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	out := make([]string, 0, len(set))
+	for k := range set {
+		out = append(out, k)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Inventory 是某台服务器已安装节点与模型的缓存快照。
+type Inventory struct {
+	NodeClasses map[string]struct{}
+	// Models 为已拉取过的模型目录 -> 文件名集合，按需懒加载。
+	Models    map[string]map[string]struct{}
+	FetchedAt time.Time
+}
+
+// HasNode 判断服务器是否注册了指定节点。
+func (inv *Inventory) HasNode(classType string) bool {
+	_, ok := inv.NodeClasses[classType]
+	return ok
+}
+
+// HasModel 判断服务器指定目录中是否存在该模型文件。
+func (inv *Inventory) HasModel(folder, filename string) bool {
+	_, ok := inv.Models[folder][filename]
+	return ok
+}
+
+// NoEligibleServerError 列出每台服务器缺失的节点和模型。
+type NoEligibleServerError struct {
+	// Missing 为 服务器地址 -> 缺失内容。
+	Missing map[string]Requirements
+	// Unreachable 为 服务器地址 -> 拉取能力信息时的错误。
+	Unreachable map[string]error
+}
+
+func (e *NoEligibleServerError) Error() string {
+	servers := make([]string, 0, len(e.Missing)+len(e.Unreachable))
+	for s := range e.Missing {
+		servers = append(servers, s)
+	}
+	for s := range e.Unreachable {
+		servers = append(servers, s)
+	}
+	sort.Strings(servers)
+
+	var b strings.Builder
+	b.WriteString(ErrNoEligibleServer.Error())
+	for _, s := range servers {
+		if err, ok := e.Unreachable[s]; ok {
+			fmt.Fprintf(&b, "; %s: unreachable: %v", s, err)
+			continue
+		}
+		fmt.Fprintf(&b, "; %s: missing %s", s, e.Missing[s])
+	}
+	return b.String()
+}
+
+func (e *NoEligibleServerError) Unwrap() error { return ErrNoEligibleServer }
+
+// RouterOption 用于自定义 Router。
+type RouterOption func(*Router)
+
+// WithCapabilityTTL 设置服务器能力缓存的有效期（默认 5 分钟，<=0 表示永不过期）。
+func WithCapabilityTTL(d time.Duration) RouterOption {
+	return func(r *Router) { r.ttl = d }
+}
+
+// WithModelInputFolders 覆盖节点输入名到模型目录的映射，规则同 DefaultModelInputFolders。
+func WithModelInputFolders(folders map[string]string) RouterOption {
+	return func(r *Router) { r.folders = folders }
+}
+
+// Router 根据工作流所需的节点和模型，将其路由到具备这些能力的服务器。
+type Router struct {
+	clients []*Client
+	ttl     time.Duration
+	folders map[string]string
+
+	mu          sync.Mutex
+	inventories map[*Client]*Inventory
+	next        int
+}
+
+// NewRouter 基于一组客户端创建路由器。
+func NewRouter(clients []*Client, opts ...RouterOption) *Router {
+	r := &Router{
+		clients:     clients,
+		ttl:         5 * time.Minute,
+		folders:     DefaultModelInputFolders,
+		inventories: make(map[*Client]*Inventory),
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Clients 返回路由器管理的客户端。
+func (r *Router) Clients() []*Client {
+	return r.clients
+}
+
+// Requirements 使用路由器配置的映射分析工作流需求。
+func (r *Router) Requirements(workflow JSON) Requirements {
+	return workflowRequirements(workflow, r.folders)
+}
+
+// Refresh 丢弃缓存并重新拉取所有服务器的节点列表，返回遇到的第一个错误。
+func (r *Router) Refresh(ctx context.Context) error {
+	r.mu.Lock()
+	r.inventories = make(map[*Client]*Inventory)
+	r.mu.Unlock()
+
+	var firstErr error
+	for _, c := range r.clients {
+		if _, err := r.Inventory(ctx, c, nil); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", c.getBaseURL(), err)
+		}
+	}
+	return firstErr
+}
+
+// Invalidate 丢弃指定客户端的缓存（如安装新模型后）。
+func (r *Router) Invalidate(c *Client) {
+	r.mu.Lock()
+	delete(r.inventories, c)
+	r.mu.Unlock()
+}
+
+// Inventory 返回客户端的能力快照，必要时拉取 /object_info 以及 folders 中尚未缓存的模型目录。
+// 服务器没有的目录按空目录缓存；拉取目录的其他错误会被返回，调用方可据此区分服务器暂时不可用与缺少模型。
+func (r *Router) Inventory(ctx context.Context, c *Client, folders []string) (*Inventory, error) {
+	r.mu.Lock()
+	inv := r.inventories[c]
+	if inv != nil && r.ttl > 0 && time.Since(inv.FetchedAt) > r.ttl {
+		inv = nil
+	}
+	r.mu.Unlock()
+
+	if inv == nil {
+		info, err := c.GetObjectInfo(ctx)
+		if err != nil {
+			return nil, err
+		}
+		inv = &Inventory{
+			NodeClasses: make(map[string]struct{}, len(info)),
+			Models:      make(map[string]map[string]struct{}),
+			FetchedAt:   time.Now(),
+		}
+		for class := range info {
+			inv.NodeClasses[class] = struct{}{}
+		}
+	}
+
+	// 快照创建后不再修改，补充模型目录时生成新的快照
+	var missing []string
+	for _, f := range folders {
+		if _, ok := inv.Models[f]; !ok {
+			missing = append(missing, f)
+		}
+	}
+
+	fetched := make(map[string]map[string]struct{}, len(missing))
+	var fetchErr error
+	for _, f := range missing {
+		set, err := fetchModelFolder(ctx, c, f)
+		if err != nil {
+			fetchErr = err
+			break
+		}
+		fetched[f] = set
+	}
+
+	// 已拉取的目录（包括服务器没有的空目录）写入缓存，随快照一起过期
+	inv = inv.withModels(fetched)
+	r.mu.Lock()
+	r.inventories[c] = inv
+	r.mu.Unlock()
+	if fetchErr != nil {
+		return nil, fetchErr
+	}
+	return inv, nil
+}
+
+// fetchModelFolder 拉取模型目录及其旧名称（ModelFolderAliases）下的文件并合并。
+// 服务器没有的目录视为空；其他错误（网络、5xx 等）原样返回，以便与缺少模型区分。
+func fetchModelFolder(ctx context.Context, c *Client, folder string) (map[string]struct{}, error) {
+	set := make(map[string]struct{})
+	for _, name := range append([]string{folder}, ModelFolderAliases[folder]...) {
+		names, err := c.GetModels(ctx, name)
+		if errors.Is(err, ErrModelFolderNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range names {
+			set[n] = struct{}{}
+		}
+	}
+	return set, nil
+}
+
+// withModels 返回合并了额外模型目录的新快照。
+func (inv *Inventory) withModels(models map[string]map[string]struct{}) *Inventory {
+	if len(models) == 0 {
+		return inv
+	}
+	updated := &Inventory{
+		NodeClasses: inv.NodeClasses,
+		Models:      make(map[string]map[string]struct{}, len(inv.Models)+len(models)),
+		FetchedAt:   inv.FetchedAt,
+	}
+	for f, set := range inv.Models {
+		updated.Models[f] = set
+	}
+	for f, set := range models {
+		updated.Models[f] = set
+	}
+	return updated
+}
+
+// Eligible 返回满足工作流需求的全部客户端；若没有则返回 *NoEligibleServerError。
+func (r *Router) Eligible(ctx context.Context, workflow JSON) ([]*Client, error) {
+	req := r.Requirements(workflow)
+	folders := make([]string, 0, len(req.Models))
+	for f := range req.Models {
+		folders = append(folders, f)
+	}
+	sort.Strings(folders)
+
+	var eligible []*Client
+	noneErr := &NoEligibleServerError{
+		Missing:     make(map[string]Requirements),
+		Unreachable: make(map[string]error),
+	}
+	for _, c := range r.clients {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		inv, err := r.Inventory(ctx, c, folders)
+		if err != nil {
+			noneErr.Unreachable[c.getBaseURL()] = err
+			continue
+		}
+		miss := missingRequirements(inv, req)
+		if miss.IsEmpty() {
+			eligible = append(eligible, c)
+			continue
+		}
+		noneErr.Missing[c.getBaseURL()] = miss
+	}
+	if len(eligible) == 0 {
+		return nil, noneErr
+	}
+	return eligible, nil
+}
+
+func missingRequirements(inv *Inventory, req Requirements) Requirements {
+	var miss Requirements
+	for _, class := range req.ClassTypes {
+		if !inv.HasNode(class) {
+			miss.ClassTypes = append(miss.ClassTypes, class)
+		}
+	}
+	for folder, files := range req.Models {
+		for _, f := range files {
+			if inv.HasModel(folder, f) {
+				continue
+			}
+			if miss.Models == nil {
+				miss.Models = make(map[string][]string)
+			}
+			miss.Models[folder] = append(miss.Models[folder], f)
+		}
+	}
+	return miss
+}
+
+// Select 在满足需求的客户端中轮询选择一个。
+func (r *Router) Select(ctx context.Context, workflow JSON) (*Client, error) {
+	eligible, err := r.Eligible(ctx, workflow)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	c := eligible[r.next%len(eligible)]
+	r.next++
+	r.mu.Unlock()
+	return c, nil
+}
+
+// Prompt 选择合适的服务器并提交工作流，返回所用客户端和 prompt_id。
+func (r *Router) Prompt(ctx context.Context, workflow JSON) (*Client, string, error) {
+	c, err := r.Select(ctx, workflow)
+	if err != nil {
+		return nil, "", err
+	}
+	promptID, err := c.Prompt(ctx, workflow)
+	if err != nil {
+		return c, "", err
+	}
+	return c, promptID, nil
+}
@@ -0,0 +1,302 @@
+package comfyui2go
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRunCancelled 表示 Run 被 Cancel 取消
+var ErrRunCancelled = errors.New("run cancelled")
+
+// Event 为 Run 的执行事件，对应该 prompt 的 WebSocket 消息
+type Event struct {
+	// Type 为消息类型，如 "execution_start"、"execution_cached"、"executing"、"progress"、
+	// "executed"、"execution_success"、"execution_error"、"execution_interrupted"；
+	// progress_state 消息按节点拆分为多个 "progress" 事件
+	Type     string
+	PromptID string
+	// Node 为相关节点ID（executing、progress、executed）
+	Node string
+	// Progress 为节点内进度（仅 progress）
+	Progress *WSProgressMessage
+	// Outputs 为节点产生的输出文件（仅 executed）
+	Outputs []OutputAsset
+	// Data 为原始消息数据
+	Data JSON
+	Time time.Time
+}
+
+// RunOption 用于自定义 Run
+type RunOption func(*runOptions)
+
+type runOptions struct {
+	wait  []WaitOption
+	types map[string]bool
+}
+
+// WithRunWaitOptions 设置等待任务结束时使用的选项（轮询间隔等）
+func WithRunWaitOptions(opts ...WaitOption) RunOption {
+	return func(o *runOptions) { o.wait = append(o.wait, opts...) }
+}
+
+// WithOutputTypes 只投递指定类型的输出文件（如只要 "output"，忽略预览节点的 "temp"）
+func WithOutputTypes(types ...string) RunOption {
+	return func(o *runOptions) {
+		if o.types == nil {
+			o.types = make(map[string]bool)
+		}
+		for _, t := range types {
+			o.types[t] = true
+		}
+	}
+}
+
+// Run 是一次提交并等待的句柄：实时转发执行事件，节点执行完立即投递其输出文件。
+type Run struct {
+	client  *Client
+	opts    runOptions
+	done    chan struct{}
+	events  chan Event
+	outputs chan OutputAsset
+
+	mu        sync.Mutex
+	promptID  string
+	pending   []WSMessage // 提交响应返回前收到的消息
+	running   bool        // 已收到本 prompt 的 executing，用于转发不带 prompt_id 的进度
+	finished  bool
+	cancelled bool
+	seen      map[string]bool
+	outQueue  []OutputAsset
+	outSignal chan struct{}
+	pumping   bool
+	result    *WaitResult
+	err       error
+	stop      context.CancelFunc
+}
+
+// Run 提交工作流并在后台等待其结束，返回可订阅事件与输出的句柄。
+// ctx 约束提交和等待；ctx 结束后 Run 以 ctx 的错误结束，但服务器上的任务不受影响（需要时调用 Cancel）。
+// 启用 WebSocket 时输出随 executed 事件逐个投递；否则在任务结束后从历史记录一次性投递。
+func (c *Client) Run(ctx context.Context, workflow JSON, opts ...RunOption) (*Run, error) {
+	r := &Run{
+		client:    c,
+		done:      make(chan struct{}),
+		events:    make(chan Event, 256),
+		outputs:   make(chan OutputAsset),
+		seen:      make(map[string]bool),
+		outSignal: make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(&r.opts)
+	}
+
+	// 先注册监听再提交，避免错过提交响应返回前的事件
+	var unlisten func()
+	if c.wsEnabled {
+		if err := c.ensureWebSocketConnected(ctx); err == nil {
+			unlisten = c.addWSListener(r.observe)
+		}
+	}
+	promptID, err := c.Prompt(ctx, workflow)
+	if err != nil {
+		if unlisten != nil {
+			unlisten()
+		}
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.promptID = promptID
+	pending := r.pending
+	r.pending = nil
+	for _, msg := range pending {
+		r.handleLocked(msg)
+	}
+	r.mu.Unlock()
+
+	runCtx, stop := context.WithCancel(ctx)
+	r.stop = stop
+	go func() {
+		defer stop()
+		result, err := c.Wait(runCtx, promptID, r.opts.wait...)
+		if unlisten != nil {
+			unlisten()
+		}
+		r.finish(result, err)
+	}()
+	return r, nil
+}
+
+// PromptID 返回服务器分配的 prompt_id
+func (r *Run) PromptID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.promptID
+}
+
+// Events 返回执行事件通道，任务结束后关闭。消费过慢时会丢弃事件。
+func (r *Run) Events() <-chan Event { return r.events }
+
+// Outputs 返回输出文件通道，每个节点执行完成后立即投递其输出，全部投递后关闭。
+// 输出不会被丢弃；调用 Outputs 后应读到通道关闭为止。
+func (r *Run) Outputs() <-chan OutputAsset {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.pumping {
+		r.pumping = true
+		go r.pump()
+	}
+	return r.outputs
+}
+
+// Done 返回在 Run 结束时关闭的通道
+func (r *Run) Done() <-chan struct{} { return r.done }
+
+// Wait 等待任务结束并返回结果；ctx 取消只结束等待，不会取消任务。
+// 任务失败时同时返回结果与 *ExecutionError，被取消时返回 ErrRunCancelled。
+func (r *Run) Wait(ctx context.Context) (*WaitResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-r.done:
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.result, r.err
+}
+
+// Cancel 取消任务：执行中的任务被中断，仍在排队的任务从服务器队列删除，Run 以 ErrRunCancelled 结束
+func (r *Run) Cancel(ctx context.Context) error {
+	if err := r.client.InterruptPrompt(ctx, r.PromptID()); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	if !r.finished {
+		r.cancelled = true
+	}
+	r.mu.Unlock()
+	r.stop()
+	return nil
+}
+
+// observe 接收 WebSocket 消息
+func (r *Run) observe(msg WSMessage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.finished {
+		return
+	}
+	if r.promptID == "" {
+		r.pending = append(r.pending, msg)
+		return
+	}
+	r.handleLocked(msg)
+}
+
+// handleLocked 将属于本 prompt 的消息转为事件和输出，调用方需持有 r.mu
+func (r *Run) handleLocked(msg WSMessage) {
+	if msg.Type == "progress" || msg.Type == "progress_state" {
+		// 按服务器能力解析；旧版本服务器的进度消息不带 prompt_id
+		for _, p := range progressFor(r.client.cachedCapabilities(), msg, r.promptID, r.running) {
+			p := p
+			r.emitLocked(Event{Type: "progress", PromptID: r.promptID, Node: p.Node, Progress: &p, Data: msg.Data, Time: time.Now()})
+		}
+		return
+	}
+	id, _ := msg.Data["prompt_id"].(string)
+	if id != r.promptID {
+		return
+	}
+
+	ev := Event{Type: msg.Type, PromptID: id, Data: msg.Data, Time: time.Now()}
+	switch msg.Type {
+	case "executing":
+		ev.Node, _ = msg.Data["node"].(string)
+		r.running = ev.Node != ""
+	case "executed":
+		ev.Node, _ = msg.Data["node"].(string)
+		ev.Outputs = nodeOutputAssets(ev.Node, msg.Data["output"])
+		r.queueOutputsLocked(ev.Outputs)
+	case "execution_success", "execution_error", "execution_interrupted":
+		r.running = false
+	case "execution_start", "execution_cached":
+	default:
+		return
+	}
+	r.emitLocked(ev)
+}
+
+// emitLocked 发送事件，缓冲区满时丢弃，调用方需持有 r.mu
+func (r *Run) emitLocked(ev Event) {
+	select {
+	case r.events <- ev:
+	default:
+	}
+}
+
+// queueOutputsLocked 去重并按类型过滤后加入投递队列，调用方需持有 r.mu
+func (r *Run) queueOutputsLocked(assets []OutputAsset) {
+	added := false
+	for _, a := range assets {
+		if r.opts.types != nil && !r.opts.types[a.Type] {
+			continue
+		}
+		key := a.NodeID + "\x00" + a.Kind + "\x00" + a.Type + "\x00" + a.Subfolder + "\x00" + a.Filename
+		if r.seen[key] {
+			continue
+		}
+		r.seen[key] = true
+		r.outQueue = append(r.outQueue, a)
+		added = true
+	}
+	if added {
+		select {
+		case r.outSignal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// pump 将队列中的输出依次送入 outputs 通道，结束且队列为空时关闭通道
+func (r *Run) pump() {
+	for {
+		r.mu.Lock()
+		if len(r.outQueue) == 0 {
+			finished := r.finished
+			r.mu.Unlock()
+			if finished {
+				close(r.outputs)
+				return
+			}
+			<-r.outSignal
+			continue
+		}
+		a := r.outQueue[0]
+		r.outQueue = r.outQueue[1:]
+		r.mu.Unlock()
+		r.outputs <- a
+	}
+}
+
+// finish 记录结果，补投历史记录中未通过事件收到的输出，并关闭通道
+func (r *Run) finish(result *WaitResult, err error) {
+	r.mu.Lock()
+	if r.cancelled {
+		err = ErrRunCancelled
+	}
+	if result != nil {
+		r.queueOutputsLocked(result.Item.Assets())
+	}
+	r.result, r.err = result, err
+	r.finished = true
+	close(r.events)
+	r.mu.Unlock()
+
+	select {
+	case r.outSignal <- struct{}{}:
+	default:
+	}
+	close(r.done)
+}
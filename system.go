@@ -0,0 +1,106 @@
+package comfyui2go
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// GetSystemStats 调用 GET /system_stats 获取服务器系统信息和设备显存情况。
+func (c *Client) GetSystemStats(ctx context.Context) (*SystemStats, error) {
+	var out SystemStats
+	r, err := c.cli.R().SetContext(ctx).SetResult(&out).Get("/system_stats")
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("/system_stats failed: %s", r.String())
+	}
+	return &out, nil
+}
+
+// FreeOptions 对应 POST /free 的请求体。
+// 服务器在当前任务执行完后处理该请求，不会打断正在运行的任务。
+type FreeOptions struct {
+	// UnloadModels 卸载所有已加载的模型
+	UnloadModels bool `json:"unload_models,omitempty"`
+	// FreeMemory 释放缓存的节点输出和显存
+	FreeMemory bool `json:"free_memory,omitempty"`
+}
+
+// Free 调用 POST /free 卸载模型和/或释放显存。
+func (c *Client) Free(ctx context.Context, opts FreeOptions) error {
+	r, err := c.cli.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(opts).
+		Post("/free")
+	if err != nil {
+		return err
+	}
+	if !r.IsSuccess() {
+		return fmt.Errorf("/free failed: %s", r.String())
+	}
+	return nil
+}
+
+// AutoFreePolicy 自动释放策略：提交的工作流与上一次提交的模型族不同时，先调用 Free。
+// 经由该客户端提交的任务（包括 Router 和 JobQueue）都会应用此策略。
+type AutoFreePolicy struct {
+	// Family 返回工作流的模型族标识，返回空字符串表示无法判断（不触发释放）。
+	// 为 nil 时使用 DefaultModelFamily。
+	Family func(workflow JSON) string
+	// Options 为释放时使用的参数，零值时等同于同时卸载模型和释放显存
+	Options FreeOptions
+}
+
+// WithAutoFree 启用自动释放策略。
+func WithAutoFree(policy AutoFreePolicy) Option {
+	return func(c *Client) { c.autoFree = &policy }
+}
+
+// modelFamilyFolders 为决定模型族的主模型目录
+var modelFamilyFolders = []string{"checkpoints", "diffusion_models", "unet"}
+
+// DefaultModelFamily 以工作流引用的主模型（checkpoints、diffusion_models、unet 目录下的文件）作为模型族，
+// 形如 "checkpoints/sd_xl_base_1.0.safetensors"，多个模型以逗号连接。LoRA、VAE 等附属模型不参与判断。
+func DefaultModelFamily(workflow JSON) string {
+	req := WorkflowRequirements(workflow)
+	var parts []string
+	for _, folder := range modelFamilyFolders {
+		for _, name := range req.Models[folder] {
+			parts = append(parts, folder+"/"+name)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// applyAutoFree 在提交前按策略释放显存，释放失败时不记录新的模型族以便下次重试
+func (c *Client) applyAutoFree(ctx context.Context, workflow JSON) error {
+	if c.autoFree == nil {
+		return nil
+	}
+	familyOf := c.autoFree.Family
+	if familyOf == nil {
+		familyOf = DefaultModelFamily
+	}
+	family := familyOf(workflow)
+	if family == "" {
+		return nil
+	}
+
+	c.freeMu.Lock()
+	defer c.freeMu.Unlock()
+	if c.lastFamily != "" && c.lastFamily != family {
+		opts := c.autoFree.Options
+		if opts == (FreeOptions{}) {
+			opts = FreeOptions{UnloadModels: true, FreeMemory: true}
+		}
+		c.log().Info("comfyui auto free", "from", c.lastFamily, "to", family)
+		if err := c.Free(ctx, opts); err != nil {
+			return fmt.Errorf("auto free: %w", err)
+		}
+	}
+	c.lastFamily = family
+	return nil
+}
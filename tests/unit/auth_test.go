@@ -0,0 +1,129 @@
+package unit
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+)
+
+// newAuthServer 返回只接受 authorized(r) 为 true 的请求的服务器，WebSocket 握手同样校验
+func newAuthServer(t *testing.T, authorized func(r *http.Request) bool) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"queue_running": []interface{}{}, "queue_pending": []interface{}{}})
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Read(context.Background())
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// checkAuth 验证 HTTP 请求与 WebSocket 握手都通过认证
+func checkAuth(t *testing.T, client *comfyui2go.Client) {
+	t.Helper()
+	defer client.CloseWebSocket()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.GetQueue(ctx); err != nil {
+		t.Errorf("HTTP 请求应通过认证: %v", err)
+	}
+	if _, err := client.GetWebSocketClient(ctx); err != nil {
+		t.Errorf("WebSocket 握手应通过认证: %v", err)
+	}
+}
+
+// TestAuthenticators 测试各种认证方式同时作用于 HTTP 与 WebSocket
+func TestAuthenticators(t *testing.T) {
+	t.Run("基本认证", func(t *testing.T) {
+		srv := newAuthServer(t, func(r *http.Request) bool {
+			u, p, ok := r.BasicAuth()
+			return ok && u == "admin" && p == "secret"
+		})
+		checkAuth(t, comfyui2go.NewClientWithOptions("auth-test", srv.URL, comfyui2go.WithBasicAuth("admin", "secret")))
+	})
+
+	t.Run("固定请求头", func(t *testing.T) {
+		srv := newAuthServer(t, func(r *http.Request) bool { return r.Header.Get("X-API-Key") == "k1" })
+		checkAuth(t, comfyui2go.NewClientWithOptions("auth-test", srv.URL,
+			comfyui2go.WithAuthenticator(comfyui2go.StaticHeaders(map[string]string{"X-API-Key": "k1"}))))
+	})
+
+	t.Run("可刷新令牌", func(t *testing.T) {
+		var mu sync.Mutex
+		valid := "tok-1"
+		srv := newAuthServer(t, func(r *http.Request) bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return r.Header.Get("Authorization") == "Bearer "+valid
+		})
+		fetches := 0
+		auth := comfyui2go.RefreshableToken(func(ctx context.Context) (string, time.Time, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetches++
+			return fmt.Sprintf("tok-%d", fetches), time.Now().Add(time.Hour), nil
+		})
+		client := comfyui2go.NewClientWithOptions("auth-test", srv.URL, comfyui2go.WithAuthenticator(auth))
+		checkAuth(t, client)
+
+		// 服务器轮换令牌后，401 使旧令牌失效，下一次请求自动刷新
+		mu.Lock()
+		valid = "tok-2"
+		mu.Unlock()
+		if _, err := client.GetQueue(context.Background()); err == nil {
+			t.Error("旧令牌应被拒绝")
+		}
+		if _, err := client.GetQueue(context.Background()); err != nil {
+			t.Errorf("刷新后的令牌应通过认证: %v", err)
+		}
+	})
+
+	t.Run("Cookie 登录", func(t *testing.T) {
+		srv := newAuthServer(t, func(r *http.Request) bool {
+			ck, err := r.Cookie("session")
+			return err == nil && ck.Value == "s1"
+		})
+		login := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+			if r.PostForm.Get("password") != "pw" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+			http.Redirect(w, r, "/", http.StatusFound)
+		}))
+		defer login.Close()
+
+		auth := comfyui2go.CookieLogin(login.URL+"/login", url.Values{"password": {"pw"}})
+		checkAuth(t, comfyui2go.NewClientWithOptions("auth-test", srv.URL, comfyui2go.WithAuthenticator(auth)))
+
+		bad := comfyui2go.CookieLogin(login.URL+"/login", url.Values{"password": {"wrong"}})
+		client := comfyui2go.NewClientWithOptions("auth-test", srv.URL, comfyui2go.WithAuthenticator(bad), comfyui2go.WithoutWebSocket())
+		if _, err := client.GetQueue(context.Background()); err == nil {
+			t.Error("登录失败时请求应返回错误")
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deferz/comfyui2go"
+)
+
+func batchWorkflows(n int) []comfyui2go.JSON {
+	workflows := make([]comfyui2go.JSON, n)
+	for i := range workflows {
+		workflows[i] = markerWorkflow(strconv.Itoa(i))
+	}
+	return workflows
+}
+
+// TestBatchContinueOnError 测试有限并发、按输入顺序收集结果与汇总进度
+func TestBatchContinueOnError(t *testing.T) {
+	f := newFakeComfyServer(t)
+	f.version = "0.3.60"
+	f.failing["2"] = true
+	f.finishAfter = 2
+	client := comfyui2go.NewClientWithOptions("batch-test", f.URL, comfyui2go.WithoutWebSocket())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var updates []comfyui2go.BatchProgress
+	results, err := client.Batch(ctx, batchWorkflows(6),
+		comfyui2go.WithBatchConcurrency(2),
+		comfyui2go.WithBatchWaitOptions(comfyui2go.WithPollInterval(5*time.Millisecond)),
+		comfyui2go.WithBatchProgress(func(p comfyui2go.BatchProgress, item comfyui2go.BatchResult) {
+			updates = append(updates, p)
+		}),
+	)
+
+	var execErr *comfyui2go.ExecutionError
+	if !errors.As(err, &execErr) || execErr.PromptID != "p-2" || !strings.Contains(err.Error(), "batch item 2") {
+		t.Fatalf("错误 = %v", err)
+	}
+	if len(results) != 6 {
+		t.Fatalf("结果数 = %d", len(results))
+	}
+	for i, r := range results {
+		if r.Index != i || r.PromptID != fmt.Sprintf("p-%d", i) {
+			t.Errorf("结果 %d = %+v", i, r)
+		}
+		if (r.Err != nil) != (i == 2) || r.Result == nil {
+			t.Errorf("结果 %d: Result=%v Err=%v", i, r.Result, r.Err)
+		}
+	}
+
+	f.mu.Lock()
+	maxActive := f.maxActive
+	f.mu.Unlock()
+	if maxActive > 2 {
+		t.Errorf("并发数 = %d，超过上限", maxActive)
+	}
+	last := updates[len(updates)-1]
+	if last.Total != 6 || last.Submitted != 6 || last.Succeeded != 5 || last.Failed != 1 || last.Finished() != 6 {
+		t.Errorf("最终进度 = %+v", last)
+	}
+	for i := 1; i < len(updates); i++ {
+		if updates[i].Finished() < updates[i-1].Finished() {
+			t.Errorf("进度回退: %+v -> %+v", updates[i-1], updates[i])
+		}
+	}
+}
+
+// TestBatchFailFast 测试失败时中止：不再提交剩余任务并中断已提交的任务
+func TestBatchFailFast(t *testing.T) {
+	f := newFakeComfyServer(t)
+	f.version = "0.3.60"
+	f.failing["0"] = true
+	f.hang["1"] = true
+	client := comfyui2go.NewClientWithOptions("batch-test", f.URL, comfyui2go.WithoutWebSocket())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	results, err := client.Batch(ctx, batchWorkflows(4),
+		comfyui2go.WithBatchConcurrency(2),
+		comfyui2go.WithFailFast(),
+		comfyui2go.WithBatchWaitOptions(comfyui2go.WithPollInterval(5*time.Millisecond)),
+	)
+
+	var execErr *comfyui2go.ExecutionError
+	if !errors.As(err, &execErr) || execErr.PromptID != "p-0" {
+		t.Fatalf("错误 = %v", err)
+	}
+	if errors.Is(err, comfyui2go.ErrBatchAborted) {
+		t.Errorf("中止的任务不应计入返回的错误: %v", err)
+	}
+	for i := 1; i < 4; i++ {
+		if !errors.Is(results[i].Err, comfyui2go.ErrBatchAborted) {
+			t.Errorf("结果 %d 错误 = %v", i, results[i].Err)
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.order) != 2 {
+		t.Errorf("提交的任务 = %v", f.order)
+	}
+	if len(f.interrupted) != 1 || f.interrupted[0] != "p-1" {
+		t.Errorf("中断的任务 = %v", f.interrupted)
+	}
+}
+
+// TestBatchContextCancel 测试 ctx 结束后不再提交新任务
+func TestBatchContextCancel(t *testing.T) {
+	f := newFakeComfyServer(t)
+	f.version = "0.3.60"
+	f.hang["0"] = true
+	client := comfyui2go.NewClientWithOptions("batch-test", f.URL, comfyui2go.WithoutWebSocket())
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var last comfyui2go.BatchProgress
+	results, err := client.Batch(ctx, batchWorkflows(3),
+		comfyui2go.WithBatchConcurrency(1),
+		comfyui2go.WithBatchWaitOptions(comfyui2go.WithPollInterval(5*time.Millisecond)),
+		comfyui2go.WithBatchProgress(func(p comfyui2go.BatchProgress, item comfyui2go.BatchResult) { last = p }),
+	)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("错误 = %v", err)
+	}
+	for i, r := range results {
+		if !errors.Is(r.Err, context.DeadlineExceeded) {
+			t.Errorf("结果 %d 错误 = %v", i, r.Err)
+		}
+		// 已提交的任务以 ctx 的错误失败，未提交的任务计为中止
+		if aborted := errors.Is(r.Err, comfyui2go.ErrBatchAborted); aborted != (i > 0) {
+			t.Errorf("结果 %d 中止 = %v", i, aborted)
+		}
+	}
+	if last.Failed != 1 || last.Aborted != 2 {
+		t.Errorf("进度 = %+v", last)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.order) != 1 || len(f.interrupted) != 0 {
+		t.Errorf("submitted=%v interrupted=%v", f.order, f.interrupted)
+	}
+}
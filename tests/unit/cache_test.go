@@ -0,0 +1,116 @@
+package unit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// TestWorkflowHash 测试工作流规范哈希
+func TestWorkflowHash(t *testing.T) {
+	a := comfyui2go.JSON{
+		"1": map[string]interface{}{
+			"class_type": "KSampler",
+			"inputs":     map[string]interface{}{"seed": 42, "steps": 20},
+			"_meta":      map[string]interface{}{"title": "采样器"},
+		},
+	}
+	b := comfyui2go.JSON{
+		"1": map[string]interface{}{
+			"inputs":     map[string]interface{}{"steps": 20, "seed": 42},
+			"class_type": "KSampler",
+		},
+	}
+	c := comfyui2go.JSON{
+		"1": map[string]interface{}{
+			"class_type": "KSampler",
+			"inputs":     map[string]interface{}{"seed": 43, "steps": 20},
+		},
+	}
+
+	ha, _ := comfyui2go.WorkflowHash(a)
+	hb, _ := comfyui2go.WorkflowHash(b)
+	hc, _ := comfyui2go.WorkflowHash(c)
+	if ha != hb {
+		t.Error("仅 _meta 不同的工作流哈希应相同")
+	}
+	if ha == hc {
+		t.Error("种子不同的工作流哈希应不同")
+	}
+}
+
+// TestMemoryResultCache 测试内存 LRU 与 TTL
+func TestMemoryResultCache(t *testing.T) {
+	ctx := context.Background()
+	cache := comfyui2go.NewMemoryResultCache(2, 50*time.Millisecond)
+
+	for _, key := range []string{"a", "b", "c"} {
+		cache.Set(ctx, key, &comfyui2go.CachedResult{Key: key, StoredAt: time.Now()})
+	}
+	if _, ok, _ := cache.Get(ctx, "a"); ok {
+		t.Error("超出容量时应淘汰最久未使用的条目")
+	}
+	if _, ok, _ := cache.Get(ctx, "c"); !ok {
+		t.Error("最近写入的条目应命中")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok, _ := cache.Get(ctx, "c"); ok {
+		t.Error("过期条目不应命中")
+	}
+}
+
+// TestPromptCached 测试命中缓存时不再提交工作流
+func TestPromptCached(t *testing.T) {
+	srv := newFakeComfyServer(t)
+	cache, err := comfyui2go.NewFileResultCache(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("创建缓存失败: %v", err)
+	}
+	client := comfyui2go.NewClientWithOptions("cache-test", srv.URL,
+		comfyui2go.WithoutWebSocket(),
+		comfyui2go.WithResultCache(cache),
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, hit, err := client.PromptCached(ctx, markerWorkflow("cat"))
+	if err != nil || hit {
+		t.Fatalf("首次执行应未命中: hit=%v err=%v", hit, err)
+	}
+	if len(first.Assets) != 1 || string(first.Assets[0].Data) != "image:cat.png" {
+		t.Fatalf("应下载输出文件: %+v", first.Assets)
+	}
+
+	second, hit, err := client.PromptCached(ctx, markerWorkflow("cat"))
+	if err != nil || !hit {
+		t.Fatalf("第二次执行应命中缓存: hit=%v err=%v", hit, err)
+	}
+	if second.Result.PromptID != first.Result.PromptID || string(second.Assets[0].Data) != "image:cat.png" {
+		t.Errorf("缓存结果不一致: %+v", second)
+	}
+	if n := len(srv.submitted()); n != 1 {
+		t.Errorf("工作流应只提交一次, 实际 %d 次", n)
+	}
+}
+
+// TestPromptCachedWithoutWebSocket 测试 WebSocket 无法连接时改为轮询等待，而不是在提交后报错
+func TestPromptCachedWithoutWebSocket(t *testing.T) {
+	srv := newFakeComfyServer(t)
+	srv.rejectWS = true
+	client := comfyui2go.NewClientWithOptions("cache-test", srv.URL)
+	defer client.CloseWebSocket()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, hit, err := client.PromptCached(ctx, markerWorkflow("dog"))
+	if err != nil || hit {
+		t.Fatalf("PromptCached = hit=%v err=%v", hit, err)
+	}
+	if len(res.Assets) != 1 || string(res.Assets[0].Data) != "image:dog.png" {
+		t.Errorf("应下载输出文件: %+v", res.Assets)
+	}
+}
@@ -0,0 +1,242 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+	resty "resty.dev/v3"
+)
+
+// TestProbe 测试新旧两种服务器的能力探测
+func TestProbe(t *testing.T) {
+	stats := map[string]interface{}{"system": map[string]interface{}{"comfyui_version": "0.3.41"}, "devices": []interface{}{}}
+
+	t.Run("新版本服务器", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/system_stats", func(w http.ResponseWriter, r *http.Request) { writeJSON(w, stats) })
+		mux.HandleFunc("/api/features", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"supports_preview_metadata": true, "max_upload_size": 104857600})
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		client := comfyui2go.NewClientWithOptions("probe-test", srv.URL, comfyui2go.WithoutWebSocket())
+		caps, err := client.Capabilities(context.Background())
+		if err != nil {
+			t.Fatalf("探测失败: %v", err)
+		}
+		if !caps.APIPrefix || !caps.SupportsPreviewMetadata || caps.MaxUploadSize != 104857600 || caps.Version != "0.3.41" {
+			t.Errorf("能力解析不正确: %+v", caps)
+		}
+		if !caps.AtLeast("0.3.9") || !caps.AtLeast("v0.3.41") || caps.AtLeast("0.4.0") {
+			t.Errorf("版本比较不正确: %s", caps.Version)
+		}
+		if again, _ := client.Capabilities(context.Background()); again != caps {
+			t.Error("能力信息应被缓存")
+		}
+	})
+
+	t.Run("旧版本服务器", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/system_stats", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"system": map[string]interface{}{"os": "posix"}})
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		client := comfyui2go.NewClientWithOptions("probe-test", srv.URL, comfyui2go.WithoutWebSocket())
+		caps, err := client.Probe(context.Background())
+		if err != nil {
+			t.Fatalf("旧版本服务器不应返回错误: %v", err)
+		}
+		if caps.APIPrefix || caps.Features != nil || caps.Version != "" || caps.AtLeast("0.0.1") {
+			t.Errorf("能力解析不正确: %+v", caps)
+		}
+	})
+}
+
+// TestInterruptPrompt 测试只中断指定的 prompt，并按服务器版本选择 /interrupt 的请求形式
+func TestInterruptPrompt(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		version  string
+		targeted bool
+	}{
+		{"旧版本服务器", "", false},
+		{"支持定向中断的服务器", "0.3.60", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var interrupts []map[string]interface{}
+			var deleted []interface{}
+			mux := http.NewServeMux()
+			mux.HandleFunc("/system_stats", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, map[string]interface{}{"system": map[string]interface{}{"comfyui_version": tc.version}})
+			})
+			mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					var body map[string][]interface{}
+					json.NewDecoder(r.Body).Decode(&body)
+					mu.Lock()
+					deleted = append(deleted, body["delete"]...)
+					mu.Unlock()
+					return
+				}
+				writeJSON(w, map[string]interface{}{
+					"queue_running": []interface{}{[]interface{}{1, "running", map[string]interface{}{}, map[string]interface{}{}, []interface{}{}}},
+					"queue_pending": []interface{}{[]interface{}{2, "pending", map[string]interface{}{}, map[string]interface{}{}, []interface{}{}}},
+				})
+			})
+			mux.HandleFunc("/interrupt", func(w http.ResponseWriter, r *http.Request) {
+				body := map[string]interface{}{}
+				json.NewDecoder(r.Body).Decode(&body)
+				mu.Lock()
+				interrupts = append(interrupts, body)
+				mu.Unlock()
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			ctx := context.Background()
+			client := comfyui2go.NewClientWithOptions("interrupt-test", srv.URL, comfyui2go.WithoutWebSocket())
+			for _, id := range []string{"running", "pending", "finished"} {
+				if err := client.InterruptPrompt(ctx, id); err != nil {
+					t.Fatalf("中断 %s 失败: %v", id, err)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(interrupts) != 1 {
+				t.Fatalf("只应对运行中的 prompt 调用 /interrupt: %v", interrupts)
+			}
+			if got, _ := interrupts[0]["prompt_id"].(string); (got == "running") != tc.targeted || (!tc.targeted && len(interrupts[0]) != 0) {
+				t.Errorf("/interrupt 请求体 = %v", interrupts[0])
+			}
+			if len(deleted) != 1 || deleted[0] != "pending" {
+				t.Errorf("排队中的 prompt 应从队列删除: %v", deleted)
+			}
+		})
+	}
+}
+
+// TestCapabilityNegotiation 测试连接时自动探测并按服务器版本选择路由前缀与进度消息格式
+func TestCapabilityNegotiation(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		prefix string // 服务器路由所在的命名空间
+		stats  map[string]interface{}
+		// 服务器发送的进度消息
+		messages []map[string]interface{}
+		want     []comfyui2go.WSProgressMessage
+	}{
+		{
+			name:   "旧版本服务器",
+			prefix: "",
+			stats:  map[string]interface{}{"system": map[string]interface{}{"os": "posix"}},
+			messages: []map[string]interface{}{
+				{"type": "progress", "data": map[string]interface{}{"value": 1, "max": 4}},
+				{"type": "progress_state", "data": map[string]interface{}{"prompt_id": "p1", "nodes": map[string]interface{}{}}},
+			},
+			want: []comfyui2go.WSProgressMessage{{Value: 1, Max: 4}},
+		},
+		{
+			name:   "只转发 /api 的新版本服务器",
+			prefix: "/api",
+			stats:  map[string]interface{}{"system": map[string]interface{}{"comfyui_version": "0.3.60"}},
+			messages: []map[string]interface{}{
+				{"type": "progress", "data": map[string]interface{}{"value": 1, "max": 4, "prompt_id": "p1", "node": "3"}},
+				{"type": "progress_state", "data": map[string]interface{}{"prompt_id": "p1", "nodes": map[string]interface{}{
+					"3": map[string]interface{}{"value": 2.0, "max": 4.0, "state": "running", "node_id": "3", "display_node_id": "3"},
+					"4": map[string]interface{}{"value": 0.0, "max": 1.0, "state": "finished", "node_id": "4"},
+				}}},
+			},
+			want: []comfyui2go.WSProgressMessage{{Value: 2, Max: 4, PromptID: "p1", Node: "3"}},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			connected := make(chan *websocket.Conn, 1)
+			mux := http.NewServeMux()
+			mux.HandleFunc(tc.prefix+"/system_stats", func(w http.ResponseWriter, r *http.Request) { writeJSON(w, tc.stats) })
+			mux.HandleFunc(tc.prefix+"/queue", func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, map[string]interface{}{"queue_running": []interface{}{}, "queue_pending": []interface{}{}})
+			})
+			mux.HandleFunc(tc.prefix+"/ws", func(w http.ResponseWriter, r *http.Request) {
+				c, err := websocket.Accept(w, r, nil)
+				if err != nil {
+					return
+				}
+				connected <- c
+				for {
+					if _, _, err := c.Read(context.Background()); err != nil {
+						return
+					}
+				}
+			})
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			// 调用方提供的 Resty 客户端在协商后保持原样
+			rc := resty.New().SetBaseURL(srv.URL)
+			defer rc.Close()
+			progress := make(chan comfyui2go.WSProgressMessage, 8)
+			client := comfyui2go.NewClientWithOptions("negotiation-test", srv.URL,
+				comfyui2go.WithHTTP(rc),
+				comfyui2go.WithProgressCallback(func(promptID string, p comfyui2go.WSProgressMessage) {
+					if promptID != p.PromptID {
+						t.Errorf("回调 promptID = %q, 进度 = %+v", promptID, p)
+					}
+					progress <- p
+				}),
+			)
+			defer client.CloseWebSocket()
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if _, err := client.GetWebSocketClient(ctx); err != nil {
+				t.Fatalf("WebSocket 连接失败: %v", err)
+			}
+			// 协商后的并发请求都应使用探测到的路由前缀
+			var wg sync.WaitGroup
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := client.GetQueue(ctx); err != nil {
+						t.Errorf("HTTP 请求应使用探测到的路由前缀: %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+			if got := rc.BaseURL(); got != srv.URL {
+				t.Errorf("不应修改调用方的 Resty 客户端: BaseURL = %q", got)
+			}
+			conn := <-connected
+			for _, m := range tc.messages {
+				b, _ := json.Marshal(m)
+				conn.Write(ctx, websocket.MessageText, b)
+			}
+			// 收集到 300ms 内没有新的进度为止
+			var got []comfyui2go.WSProgressMessage
+			for done := false; !done; {
+				select {
+				case p := <-progress:
+					got = append(got, p)
+				case <-time.After(300 * time.Millisecond):
+					done = true
+				}
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("进度 = %+v，期望 %+v", got, tc.want)
+			}
+		})
+	}
+}
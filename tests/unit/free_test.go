@@ -0,0 +1,71 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// TestAutoFree 测试切换模型族时自动调用 /free
+func TestAutoFree(t *testing.T) {
+	var mu sync.Mutex
+	var calls []comfyui2go.FreeOptions
+	mux := http.NewServeMux()
+	mux.HandleFunc("/free", func(w http.ResponseWriter, r *http.Request) {
+		var body comfyui2go.FreeOptions
+		json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		calls = append(calls, body)
+		mu.Unlock()
+	})
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"prompt_id": "p1", "number": 1})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := comfyui2go.NewClientWithOptions("free-test", srv.URL,
+		comfyui2go.WithoutWebSocket(),
+		comfyui2go.WithAutoFree(comfyui2go.AutoFreePolicy{}),
+	)
+
+	ckpt := func(name string) comfyui2go.JSON {
+		return comfyui2go.JSON{
+			"4": map[string]interface{}{"class_type": "CheckpointLoaderSimple", "inputs": map[string]interface{}{"ckpt_name": name}},
+		}
+	}
+	for _, wf := range []comfyui2go.JSON{
+		ckpt("sd15.safetensors"),
+		ckpt("sd15.safetensors"),
+		{"1": map[string]interface{}{"class_type": "EmptyLatentImage", "inputs": map[string]interface{}{}}}, // 无法判断模型族
+		ckpt("sdxl.safetensors"),
+	} {
+		if _, err := client.Prompt(ctx, wf); err != nil {
+			t.Fatalf("提交失败: %v", err)
+		}
+	}
+
+	mu.Lock()
+	if len(calls) != 1 {
+		t.Fatalf("只有切换模型族时应释放一次, 实际 %d 次", len(calls))
+	}
+	if !calls[0].UnloadModels || !calls[0].FreeMemory {
+		t.Errorf("默认应同时卸载模型和释放显存: %+v", calls[0])
+	}
+	mu.Unlock()
+
+	if err := client.Free(ctx, comfyui2go.FreeOptions{FreeMemory: true}); err != nil {
+		t.Fatalf("Free 失败: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if last := calls[len(calls)-1]; last.UnloadModels || !last.FreeMemory {
+		t.Errorf("请求体不正确: %+v", last)
+	}
+}
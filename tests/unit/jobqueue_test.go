@@ -0,0 +1,748 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+)
+
+// fakeComfyServer 模拟 /prompt、/history、/queue、/interrupt 与 /ws：工作流 {"marker": m} 提交后得到 prompt_id "p-m"，
+// 默认在被查询 finishAfter 次后视为执行完成；hang 中的 prompt 在 complete 之前一直未结束。
+// 已提交未结束的 prompt 出现在 queue_running 中；设置 version 后 /system_stats 报告该版本。
+type fakeComfyServer struct {
+	*httptest.Server
+
+	version     string
+	finishAfter int
+
+	mu        sync.Mutex
+	order     []string // 按提交顺序记录工作流中的 marker
+	gate      chan struct{}
+	failing   map[string]bool
+	lost      map[string]bool // 历史记录和队列中都不存在的 prompt
+	hang      map[string]bool
+	items     map[string]map[string]interface{} // 覆盖默认的历史记录
+	lookups   int                               // /history 的请求次数
+	active    map[string]int                    // 已提交未结束的 prompt 及其被查询次数
+	maxActive int
+	conn      *websocket.Conn
+	rejectWS  bool // 拒绝新的 WebSocket 连接
+
+	interrupted []string // /interrupt 请求中的 prompt_id，旧版本格式为空
+}
+
+func newFakeComfyServer(t *testing.T) *fakeComfyServer {
+	t.Helper()
+	f := &fakeComfyServer{
+		failing: map[string]bool{},
+		lost:    map[string]bool{},
+		hang:    map[string]bool{},
+		items:   map[string]map[string]interface{}{},
+		active:  map[string]int{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/system_stats", func(w http.ResponseWriter, r *http.Request) {
+		if f.version == "" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"system": map[string]interface{}{"comfyui_version": f.version}})
+	})
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Prompt map[string]interface{} `json:"prompt"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		marker, _ := body.Prompt["marker"].(string)
+
+		f.mu.Lock()
+		gate := f.gate
+		f.order = append(f.order, marker)
+		f.active["p-"+marker] = 0
+		if len(f.active) > f.maxActive {
+			f.maxActive = len(f.active)
+		}
+		f.mu.Unlock()
+		if gate != nil {
+			<-gate
+		}
+		writeJSON(w, map[string]interface{}{"prompt_id": "p-" + marker, "number": 1})
+	})
+	mux.HandleFunc("/history/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/history/")
+		marker := strings.TrimPrefix(id, "p-")
+		f.mu.Lock()
+		f.lookups++
+		failing, lost, hang := f.failing[marker], f.lost[marker], f.hang[marker]
+		item, custom := f.items[marker]
+		n, active := f.active[id]
+		pending := lost || (hang && !custom) || (active && n < f.finishAfter)
+		if active && pending {
+			f.active[id] = n + 1
+		} else {
+			delete(f.active, id)
+		}
+		f.mu.Unlock()
+		if pending {
+			writeJSON(w, map[string]interface{}{})
+			return
+		}
+		if custom {
+			writeJSON(w, map[string]interface{}{id: item})
+			return
+		}
+
+		status := map[string]interface{}{"status_str": "success", "completed": true, "messages": []interface{}{}}
+		if failing {
+			status = map[string]interface{}{"status_str": "error", "completed": false, "messages": []interface{}{
+				[]interface{}{"execution_start", map[string]interface{}{"prompt_id": id, "timestamp": 1}},
+				[]interface{}{"execution_error", map[string]interface{}{
+					"prompt_id": id, "node_id": "9", "node_type": "SaveImage",
+					"exception_type": "OSError", "exception_message": "disk full", "traceback": []interface{}{"line 1\n"},
+				}},
+			}}
+		}
+		outputs := map[string]interface{}{
+			"9": map[string]interface{}{
+				"images": []interface{}{
+					map[string]interface{}{"filename": marker + ".png", "subfolder": "", "type": "output"},
+				},
+			},
+		}
+		writeJSON(w, map[string]interface{}{
+			id: map[string]interface{}{"status": status, "outputs": outputs},
+		})
+	})
+	mux.HandleFunc("/view", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("image:" + r.URL.Query().Get("filename")))
+	})
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		running := []interface{}{}
+		for id := range f.active {
+			running = append(running, []interface{}{1, id, map[string]interface{}{}, map[string]interface{}{}, []interface{}{}})
+		}
+		writeJSON(w, map[string]interface{}{"queue_running": running, "queue_pending": []interface{}{}})
+	})
+	mux.HandleFunc("/interrupt", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			PromptID string `json:"prompt_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.interrupted = append(f.interrupted, body.PromptID)
+		delete(f.active, body.PromptID)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		reject := f.rejectWS
+		f.mu.Unlock()
+		if reject {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conn = c
+		f.mu.Unlock()
+		for {
+			if _, _, err := c.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Server.Close)
+	return f
+}
+
+func (f *fakeComfyServer) submitted() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.order...)
+}
+
+// complete 让 prompt 结束并写入历史记录，item 为 nil 时使用默认记录
+func (f *fakeComfyServer) complete(marker string, item map[string]interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.hang, marker)
+	if item != nil {
+		f.items[marker] = item
+	}
+}
+
+// waitForConn 等待服务端登记 WebSocket 连接
+func (f *fakeComfyServer) waitForConn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	for i := 0; i < 200; i++ {
+		f.mu.Lock()
+		c := f.conn
+		f.mu.Unlock()
+		if c != nil {
+			return c
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("WebSocket 未连接")
+	return nil
+}
+
+// send 通过 WebSocket 向客户端推送消息
+func (f *fakeComfyServer) send(t *testing.T, typ string, data map[string]interface{}) {
+	t.Helper()
+	c := f.waitForConn(t)
+	msg, _ := json.Marshal(map[string]interface{}{"type": typ, "data": data})
+	c.Write(context.Background(), websocket.MessageText, msg)
+}
+
+func markerWorkflow(marker string) comfyui2go.JSON {
+	return comfyui2go.JSON{"marker": marker}
+}
+
+// TestJobQueuePriority 测试按优先级和租户公平性分发
+func TestJobQueuePriority(t *testing.T) {
+	srv := newFakeComfyServer(t)
+	srv.gate = make(chan struct{})
+	client := comfyui2go.NewClientWithOptions("queue-test", srv.URL, comfyui2go.WithoutWebSocket())
+
+	q := comfyui2go.NewJobQueue([]*comfyui2go.Client{client},
+		comfyui2go.WithMaxInFlight(1),
+		comfyui2go.WithJobPollInterval(10*time.Millisecond),
+	)
+	defer q.Close()
+
+	// 第一个任务占住唯一的在途名额
+	first, _ := q.Submit(markerWorkflow("first"))
+	for len(srv.submitted()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	jobs := []*comfyui2go.Job{first}
+	for _, spec := range []struct {
+		marker   string
+		priority int
+		tenant   string
+	}{
+		{"free-a1", 0, "a"},
+		{"free-a2", 0, "a"},
+		{"free-b1", 0, "b"},
+		{"paid", 10, "c"},
+	} {
+		j, err := q.Submit(markerWorkflow(spec.marker), comfyui2go.WithPriority(spec.priority), comfyui2go.WithTenant(spec.tenant))
+		if err != nil {
+			t.Fatalf("提交任务失败: %v", err)
+		}
+		jobs = append(jobs, j)
+	}
+	close(srv.gate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, j := range jobs {
+		if _, err := j.Wait(ctx); err != nil {
+			t.Fatalf("任务 %s 失败: %v", j.ID(), err)
+		}
+		if j.State() != comfyui2go.JobSucceeded {
+			t.Errorf("任务状态应为 succeeded, 实际 %s", j.State())
+		}
+	}
+
+	want := "first,paid,free-a1,free-b1,free-a2"
+	if got := strings.Join(srv.submitted(), ","); got != want {
+		t.Errorf("分发顺序 = %s, 期望 %s", got, want)
+	}
+}
+
+// TestJobQueueStatesAndCancel 测试任务状态、失败与取消
+func TestJobQueueStatesAndCancel(t *testing.T) {
+	srv := newFakeComfyServer(t)
+	srv.failing["bad"] = true
+	client := comfyui2go.NewClientWithOptions("queue-test", srv.URL, comfyui2go.WithoutWebSocket())
+
+	q := comfyui2go.NewJobQueue([]*comfyui2go.Client{client}, comfyui2go.WithJobPollInterval(10*time.Millisecond))
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("失败状态", func(t *testing.T) {
+		j, _ := q.Submit(markerWorkflow("bad"))
+		events, stop := j.Subscribe()
+		defer stop()
+
+		_, err := j.Wait(ctx)
+		var execErr *comfyui2go.ExecutionError
+		if !errors.As(err, &execErr) || execErr.NodeID != "9" || execErr.ExceptionMessage != "disk full" || len(execErr.Traceback) != 1 {
+			t.Fatalf("执行出错的任务应返回 ExecutionError: %v", err)
+		}
+		var states []string
+		for ev := range events {
+			states = append(states, string(ev.State))
+		}
+		if got := strings.Join(states, ","); !strings.HasSuffix(got, "failed") {
+			t.Errorf("事件序列 = %s", got)
+		}
+	})
+
+	t.Run("轮询时报告执行中", func(t *testing.T) {
+		srv.mu.Lock()
+		srv.hang["slow"] = true
+		srv.mu.Unlock()
+		j, _ := q.Submit(markerWorkflow("slow"))
+		events, stop := j.Subscribe()
+		defer stop()
+
+		// 未启用 WebSocket 时，prompt 出现在 queue_running 中即进入执行中
+		for j.State() != comfyui2go.JobRunning {
+			select {
+			case <-ctx.Done():
+				t.Fatalf("任务未进入执行中: %s", j.State())
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+		srv.complete("slow", nil)
+		if _, err := j.Wait(ctx); err != nil {
+			t.Fatalf("任务失败: %v", err)
+		}
+		var states []string
+		for ev := range events {
+			if ev.State != "" {
+				states = append(states, string(ev.State))
+			}
+		}
+		if got := strings.Join(states, ","); !strings.HasSuffix(got, "running,succeeded") {
+			t.Errorf("事件序列 = %s", got)
+		}
+	})
+
+	t.Run("取消本地排队任务", func(t *testing.T) {
+		srv.mu.Lock()
+		srv.gate = make(chan struct{})
+		srv.mu.Unlock()
+
+		blocker, _ := q.Submit(markerWorkflow("blocker"))
+		queued, _ := q.Submit(markerWorkflow("queued"))
+		if err := queued.Cancel(ctx); err != nil {
+			t.Fatalf("取消失败: %v", err)
+		}
+		close(srv.gate)
+
+		if _, err := queued.Wait(ctx); err != comfyui2go.ErrJobCancelled {
+			t.Errorf("期望 ErrJobCancelled, 实际 %v", err)
+		}
+		if _, err := blocker.Wait(ctx); err != nil {
+			t.Errorf("阻塞任务应正常完成: %v", err)
+		}
+		for _, m := range srv.submitted() {
+			if m == "queued" {
+				t.Errorf("已取消的任务不应被提交: %v", srv.submitted())
+			}
+		}
+	})
+}
+
+// TestJobQueueRecover 测试通过任务日志在重启后恢复任务
+func TestJobQueueRecover(t *testing.T) {
+	srv := newFakeComfyServer(t)
+	srv.lost["gone"] = true
+	client := comfyui2go.NewClientWithOptions("queue-test", srv.URL, comfyui2go.WithoutWebSocket())
+
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	store, err := comfyui2go.NewFileJobStore(path)
+	if err != nil {
+		t.Fatalf("打开任务日志失败: %v", err)
+	}
+	defer store.Close()
+
+	// 模拟上一个进程留下的日志
+	records := []comfyui2go.JobRecord{
+		{JobID: "local", State: comfyui2go.JobQueued, Workflow: markerWorkflow("local")},
+		{JobID: "done", State: comfyui2go.JobQueued, Workflow: markerWorkflow("done")},
+		{JobID: "done", State: comfyui2go.JobSubmitted, PromptID: "p-done", Server: srv.URL},
+		{JobID: "gone", State: comfyui2go.JobQueued, Workflow: markerWorkflow("gone")},
+		{JobID: "gone", State: comfyui2go.JobRunning, PromptID: "p-gone", Server: srv.URL},
+		{JobID: "finished", State: comfyui2go.JobSucceeded, PromptID: "p-finished", Server: srv.URL},
+	}
+	for _, rec := range records {
+		if err := store.Append(rec); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+
+	var handled []string
+	var mu sync.Mutex
+	q := comfyui2go.NewJobQueue([]*comfyui2go.Client{client},
+		comfyui2go.WithJobStore(store),
+		comfyui2go.WithJobPollInterval(10*time.Millisecond),
+		comfyui2go.WithJobResultHandler(func(ctx context.Context, job *comfyui2go.Job, result *comfyui2go.WaitResult) error {
+			mu.Lock()
+			handled = append(handled, job.ID())
+			mu.Unlock()
+			return nil
+		}),
+	)
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	jobs, err := q.Recover(ctx)
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("应恢复 3 个未结束的任务, 实际 %d", len(jobs))
+	}
+
+	for _, j := range jobs {
+		_, err := j.Wait(ctx)
+		switch j.ID() {
+		case "gone":
+			if !errors.Is(err, comfyui2go.ErrPromptLost) {
+				t.Errorf("丢失的 prompt 应返回 ErrPromptLost, 实际 %v", err)
+			}
+		default:
+			if err != nil {
+				t.Errorf("任务 %s 应成功, 实际 %v", j.ID(), err)
+			}
+		}
+	}
+
+	if got := srv.submitted(); len(got) != 1 || got[0] != "local" {
+		t.Errorf("只有未提交的任务应重新提交, 实际 %v", got)
+	}
+	mu.Lock()
+	if len(handled) != 2 {
+		t.Errorf("结果处理函数应对 2 个成功任务执行, 实际 %v", handled)
+	}
+	mu.Unlock()
+
+	if err := store.Compact(); err != nil {
+		t.Fatalf("压缩日志失败: %v", err)
+	}
+	left, err := store.Load()
+	if err != nil {
+		t.Fatalf("读取日志失败: %v", err)
+	}
+	if len(left) != 0 {
+		t.Errorf("压缩后不应保留已结束的任务: %+v", left)
+	}
+}
+
+// TestJobQueueRouting 测试路由检查失败时的处理：服务器暂时不可达时保留任务，确实不满足需求时失败
+func TestJobQueueRouting(t *testing.T) {
+	srv := newFakeComfyServer(t)
+	var mu sync.Mutex
+	infoFailures := 1
+	mux := http.NewServeMux()
+	mux.HandleFunc("/object_info", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if infoFailures > 0 {
+			infoFailures--
+			http.Error(w, "starting", http.StatusServiceUnavailable)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"SaveImage": map[string]interface{}{}})
+	})
+	mux.Handle("/", srv.Config.Handler)
+	routed := httptest.NewServer(mux)
+	defer routed.Close()
+
+	client := comfyui2go.NewClientWithOptions("queue-test", routed.URL, comfyui2go.WithoutWebSocket())
+	router := comfyui2go.NewRouter([]*comfyui2go.Client{client})
+	q := comfyui2go.NewJobQueue(nil, comfyui2go.WithJobRouter(router), comfyui2go.WithJobPollInterval(10*time.Millisecond))
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("服务器暂时不可达", func(t *testing.T) {
+		wf := markerWorkflow("retry")
+		wf["9"] = map[string]interface{}{"class_type": "SaveImage", "inputs": map[string]interface{}{}}
+		j, _ := q.Submit(wf)
+		if _, err := j.Wait(ctx); err != nil {
+			t.Fatalf("服务器恢复后任务应成功: %v", err)
+		}
+	})
+
+	t.Run("没有满足需求的服务器", func(t *testing.T) {
+		wf := markerWorkflow("missing")
+		wf["9"] = map[string]interface{}{"class_type": "CustomNode", "inputs": map[string]interface{}{}}
+		j, _ := q.Submit(wf)
+		_, err := j.Wait(ctx)
+		var noneErr *comfyui2go.NoEligibleServerError
+		if !errors.As(err, &noneErr) || j.State() != comfyui2go.JobFailed {
+			t.Fatalf("期望 NoEligibleServerError, 实际 %v (%s)", err, j.State())
+		}
+	})
+}
+
+// TestJobQueueCancelDuringSubmit 测试提交请求进行中取消任务：服务器已接受的 prompt 会被撤回
+func TestJobQueueCancelDuringSubmit(t *testing.T) {
+	srv := newFakeComfyServer(t)
+	srv.gate = make(chan struct{})
+	var mu sync.Mutex
+	var deleted []interface{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			var body map[string][]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			mu.Lock()
+			deleted = append(deleted, body["delete"]...)
+			mu.Unlock()
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"queue_running": []interface{}{},
+			"queue_pending": []interface{}{[]interface{}{1, "p-late", map[string]interface{}{}, map[string]interface{}{}, []interface{}{}}},
+		})
+	})
+	mux.Handle("/", srv.Config.Handler)
+	wrapped := httptest.NewServer(mux)
+	defer wrapped.Close()
+
+	client := comfyui2go.NewClientWithOptions("queue-test", wrapped.URL, comfyui2go.WithoutWebSocket())
+	q := comfyui2go.NewJobQueue([]*comfyui2go.Client{client}, comfyui2go.WithJobPollInterval(10*time.Millisecond))
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	j, _ := q.Submit(markerWorkflow("late"))
+	for len(srv.submitted()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if err := j.Cancel(ctx); err != nil {
+		t.Fatalf("取消失败: %v", err)
+	}
+	close(srv.gate)
+
+	if _, err := j.Wait(ctx); err != comfyui2go.ErrJobCancelled {
+		t.Fatalf("期望 ErrJobCancelled, 实际 %v", err)
+	}
+	for {
+		mu.Lock()
+		n := len(deleted)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("提交期间取消的 prompt 未被撤回")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(deleted) != 1 || deleted[0] != "p-late" {
+		t.Errorf("撤回的 prompt = %v", deleted)
+	}
+	if j.PromptID() != "" {
+		t.Errorf("已取消任务不应关联 prompt: %s", j.PromptID())
+	}
+}
+
+// TestJobQueueRecoverInFlight 测试恢复的在途任务计入服务器名额：名额回落前不分发新任务，结束后计数归零
+func TestJobQueueRecoverInFlight(t *testing.T) {
+	srv := newFakeComfyServer(t)
+	var mu sync.Mutex
+	holding := true
+	mux := http.NewServeMux()
+	mux.HandleFunc("/history/", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hold := holding
+		mu.Unlock()
+		if hold && strings.HasPrefix(r.URL.Path, "/history/p-r") {
+			writeJSON(w, map[string]interface{}{})
+			return
+		}
+		srv.Config.Handler.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		running := []interface{}{}
+		for _, id := range []string{"p-r1", "p-r2"} {
+			running = append(running, []interface{}{1, id, map[string]interface{}{}, map[string]interface{}{}, []interface{}{}})
+		}
+		writeJSON(w, map[string]interface{}{"queue_running": running, "queue_pending": []interface{}{}})
+	})
+	mux.Handle("/", srv.Config.Handler)
+	wrapped := httptest.NewServer(mux)
+	defer wrapped.Close()
+	client := comfyui2go.NewClientWithOptions("queue-test", wrapped.URL, comfyui2go.WithoutWebSocket())
+
+	store, err := comfyui2go.NewFileJobStore(filepath.Join(t.TempDir(), "jobs.jsonl"))
+	if err != nil {
+		t.Fatalf("打开任务日志失败: %v", err)
+	}
+	defer store.Close()
+	for _, id := range []string{"r1", "r2"} {
+		store.Append(comfyui2go.JobRecord{JobID: id, State: comfyui2go.JobQueued, Workflow: markerWorkflow(id)})
+		store.Append(comfyui2go.JobRecord{JobID: id, State: comfyui2go.JobRunning, PromptID: "p-" + id, Server: wrapped.URL})
+	}
+
+	q := comfyui2go.NewJobQueue([]*comfyui2go.Client{client},
+		comfyui2go.WithJobStore(store),
+		comfyui2go.WithMaxInFlight(1),
+		comfyui2go.WithJobPollInterval(10*time.Millisecond),
+	)
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 恢复期间并发读取任务状态，配合 -race 检查注册后的任务不再被无锁修改
+	readerDone := make(chan struct{})
+	stopReader := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		for {
+			for _, j := range q.Jobs() {
+				j.State()
+			}
+			select {
+			case <-stopReader:
+				return
+			default:
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	recovered, err := q.Recover(ctx)
+	close(stopReader)
+	<-readerDone
+	if err != nil || len(recovered) != 2 {
+		t.Fatalf("恢复 = %d, %v", len(recovered), err)
+	}
+	if n := q.InFlight(client); n != 2 {
+		t.Errorf("恢复的任务应计入在途数, 实际 %d", n)
+	}
+
+	fresh, _ := q.Submit(markerWorkflow("fresh"))
+	time.Sleep(50 * time.Millisecond)
+	if got := srv.submitted(); len(got) != 0 {
+		t.Errorf("名额已满时不应分发新任务: %v", got)
+	}
+
+	mu.Lock()
+	holding = false
+	mu.Unlock()
+	for _, j := range append(recovered, fresh) {
+		if _, err := j.Wait(ctx); err != nil {
+			t.Fatalf("任务 %s 失败: %v", j.ID(), err)
+		}
+	}
+	for q.InFlight(client) != 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("在途数未归零: %d", q.InFlight(client))
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+}
+
+// TestFileJobStoreCompact 测试自动压缩后继续追加到新日志，关闭后拒绝写入
+func TestFileJobStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	store, err := comfyui2go.NewFileJobStore(path, comfyui2go.WithCompactEvery(2))
+	if err != nil {
+		t.Fatalf("打开任务日志失败: %v", err)
+	}
+
+	records := []comfyui2go.JobRecord{
+		{JobID: "a", State: comfyui2go.JobQueued, Workflow: markerWorkflow("a")},
+		{JobID: "a", State: comfyui2go.JobSucceeded, PromptID: "p-a"},
+		{JobID: "b", State: comfyui2go.JobQueued, Workflow: markerWorkflow("b")},
+		{JobID: "c", State: comfyui2go.JobQueued, Workflow: markerWorkflow("c")},
+		{JobID: "b", State: comfyui2go.JobRunning, PromptID: "p-b"},
+	}
+	for _, rec := range records {
+		if err := store.Append(rec); err != nil {
+			t.Fatalf("写入日志失败: %v", err)
+		}
+	}
+
+	left, err := store.Load()
+	if err != nil {
+		t.Fatalf("读取日志失败: %v", err)
+	}
+	if len(left) != 2 || left[0].JobID != "b" || left[0].State != comfyui2go.JobRunning || left[0].Workflow == nil || left[1].JobID != "c" {
+		t.Errorf("压缩后应保留未结束任务的合并记录: %+v", left)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("关闭日志失败: %v", err)
+	}
+	if err := store.Append(comfyui2go.JobRecord{JobID: "d", State: comfyui2go.JobQueued}); err == nil {
+		t.Error("关闭后追加应返回错误")
+	}
+}
+
+// TestJobQueueSharedWebSocket 测试首个任务结束后，同一客户端上其他任务仍通过共享的 WebSocket 收到事件
+func TestJobQueueSharedWebSocket(t *testing.T) {
+	srv := newFakeComfyServer(t)
+	srv.hang["a"] = true
+	srv.hang["b"] = true
+	client := comfyui2go.NewClientWithOptions("queue-test", srv.URL)
+	defer client.CloseWebSocket()
+
+	// 轮询间隔远大于测试时长，只有 WebSocket 事件才能推动任务
+	q := comfyui2go.NewJobQueue([]*comfyui2go.Client{client},
+		comfyui2go.WithMaxInFlight(2),
+		comfyui2go.WithJobPollInterval(10*time.Second),
+	)
+	defer q.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	a, _ := q.Submit(markerWorkflow("a"))
+	srv.waitForConn(t)
+	b, _ := q.Submit(markerWorkflow("b"))
+	for len(srv.submitted()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// 打开连接的任务 a 先结束
+	srv.complete("a", nil)
+	srv.send(t, "execution_success", map[string]interface{}{"prompt_id": "p-a"})
+	if _, err := a.Wait(ctx); err != nil {
+		t.Fatalf("任务 a 失败: %v", err)
+	}
+	if !client.IsWebSocketConnected() {
+		t.Fatal("任务结束后共享的 WebSocket 不应断开")
+	}
+
+	srv.send(t, "executing", map[string]interface{}{"prompt_id": "p-b", "node": "3"})
+	for b.State() != comfyui2go.JobRunning {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("任务 b 未收到执行事件: %s", b.State())
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+	srv.complete("b", nil)
+	srv.send(t, "execution_success", map[string]interface{}{"prompt_id": "p-b"})
+	if _, err := b.Wait(ctx); err != nil {
+		t.Fatalf("任务 b 失败: %v", err)
+	}
+}
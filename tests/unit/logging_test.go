@@ -0,0 +1,74 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// syncBuffer 是并发安全的日志缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestWithLogger 测试结构化日志内容与认证信息脱敏
+func TestWithLogger(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"prompt_id": "p-logged", "number": 3})
+	})
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var buf syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client := comfyui2go.NewClientWithOptions("log-test", srv.URL,
+		comfyui2go.WithoutWebSocket(),
+		comfyui2go.WithLogger(logger),
+		comfyui2go.WithAuthenticator(comfyui2go.BearerToken("super-secret")),
+	)
+
+	ctx := context.Background()
+	if _, err := client.Prompt(ctx, comfyui2go.JSON{}); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	client.GetQueue(ctx)
+
+	out := buf.String()
+	for _, want := range []string{
+		`"msg":"comfyui prompt submitted"`, `"prompt_id":"p-logged"`,
+		`"path":"/prompt"`, `"status":200`, `"latency":`,
+		`"level":"ERROR"`, `"path":"/queue"`, `"status":500`,
+		`[REDACTED]`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("日志缺少 %s:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "super-secret") {
+		t.Errorf("日志中不应出现令牌:\n%s", out)
+	}
+}
@@ -0,0 +1,127 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+)
+
+// fakeLogsServer 模拟 /internal/logs 接口与 WebSocket 日志推送
+type fakeLogsServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	conn    *websocket.Conn
+	enabled []bool // 收到的订阅开关请求
+}
+
+func newFakeLogsServer(t *testing.T) *fakeLogsServer {
+	t.Helper()
+	f := &fakeLogsServer{}
+	entries := []interface{}{
+		map[string]interface{}{"t": "2025-01-01T00:00:00", "m": "Starting server\n"},
+		map[string]interface{}{"t": "2025-01-01T00:00:01", "m": "Traceback (most recent call last):\n"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/internal/logs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, "2025-01-01T00:00:00 - Starting server\n")
+	})
+	mux.HandleFunc("/internal/logs/raw", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"entries": entries, "size": map[string]interface{}{"cols": 120, "rows": 40}})
+	})
+	mux.HandleFunc("/internal/logs/subscribe", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			ClientID string `json:"clientId"`
+			Enabled  bool   `json:"enabled"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.mu.Lock()
+		f.enabled = append(f.enabled, body.Enabled)
+		f.mu.Unlock()
+		// 握手完成后服务端才登记连接，稍等片刻
+		var conn *websocket.Conn
+		for i := 0; i < 100 && conn == nil; i++ {
+			f.mu.Lock()
+			conn = f.conn
+			f.mu.Unlock()
+			if conn == nil {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		if body.Enabled && conn != nil && body.ClientID == "logs-test" {
+			msg, _ := json.Marshal(map[string]interface{}{
+				"type": "logs",
+				"data": map[string]interface{}{"entries": entries[1:], "size": map[string]interface{}{"cols": 120, "rows": 40}},
+			})
+			conn.Write(context.Background(), websocket.MessageText, msg)
+		}
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conn = conn
+		f.mu.Unlock()
+		// 保持连接直到客户端关闭
+		for {
+			if _, _, err := conn.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Server.Close)
+	return f
+}
+
+// TestLogs 测试日志获取与实时订阅
+func TestLogs(t *testing.T) {
+	srv := newFakeLogsServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := comfyui2go.NewClientWithOptions("logs-test", srv.URL)
+	defer client.CloseWebSocket()
+
+	text, err := client.GetLogs(ctx)
+	if err != nil || text != "2025-01-01T00:00:00 - Starting server\n" {
+		t.Errorf("GetLogs = %q, %v", text, err)
+	}
+	raw, err := client.GetRawLogs(ctx)
+	if err != nil || len(raw.Entries) != 2 || raw.Size.Cols != 120 {
+		t.Fatalf("GetRawLogs = %+v, %v", raw, err)
+	}
+
+	received := make(chan []comfyui2go.LogEntry, 1)
+	unsubscribe, err := client.SubscribeLogs(ctx, func(entries []comfyui2go.LogEntry) {
+		received <- entries
+	})
+	if err != nil {
+		t.Fatalf("订阅日志失败: %v", err)
+	}
+	select {
+	case entries := <-received:
+		if len(entries) != 1 || entries[0].Message != "Traceback (most recent call last):\n" {
+			t.Errorf("推送的日志不正确: %+v", entries)
+		}
+	case <-ctx.Done():
+		t.Fatal("未收到日志推送")
+	}
+
+	unsubscribe()
+	unsubscribe() // 重复调用应无副作用
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.enabled) != 2 || !srv.enabled[0] || srv.enabled[1] {
+		t.Errorf("订阅开关请求 = %v, 期望 [true false]", srv.enabled)
+	}
+}
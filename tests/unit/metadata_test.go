@@ -0,0 +1,84 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/deferz/comfyui2go"
+	"github.com/deferz/comfyui2go/metadata"
+)
+
+// TestPNGMetadata 测试 PNG 元数据的写入与读取
+func TestPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 2)))
+
+	prompt := comfyui2go.JSON{
+		"3": map[string]interface{}{"class_type": "KSampler", "inputs": map[string]interface{}{"seed": float64(42)}},
+	}
+	workflow := comfyui2go.JSON{"version": 0.4, "nodes": []interface{}{}}
+
+	data, err := metadata.WriteWorkflowPNG(buf.Bytes(), prompt, workflow)
+	if err != nil {
+		t.Fatalf("写入元数据失败: %v", err)
+	}
+	data, err = metadata.WritePNG(data, map[string]string{"author": "测试"})
+	if err != nil {
+		t.Fatalf("写入自定义元数据失败: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Fatalf("写入后的 PNG 应可正常解码: %v", err)
+	}
+
+	md, err := metadata.Read(data)
+	if err != nil {
+		t.Fatalf("读取元数据失败: %v", err)
+	}
+	node, _ := md.Prompt["3"].(map[string]interface{})
+	if node["class_type"] != "KSampler" {
+		t.Errorf("prompt 解析不正确: %v", md.Prompt)
+	}
+	if md.Workflow["version"] != 0.4 {
+		t.Errorf("workflow 解析不正确: %v", md.Workflow)
+	}
+	if md.Text["author"] != "测试" {
+		t.Errorf("自定义条目不正确: %v", md.Text)
+	}
+}
+
+// TestWebPMetadata 测试从 WebP 的 EXIF 中读取元数据
+func TestWebPMetadata(t *testing.T) {
+	value := []byte(`prompt:{"1":{"class_type":"SaveAnimatedWEBP"}}` + "\x00")
+
+	// 小端 TIFF：IFD0 只有 0x0110 一个 ASCII 条目，值紧跟在 IFD 之后
+	tiff := []byte("II\x2a\x00\x08\x00\x00\x00")
+	ifd := make([]byte, 2+12+4)
+	binary.LittleEndian.PutUint16(ifd[0:], 1)
+	binary.LittleEndian.PutUint16(ifd[2:], 0x0110)
+	binary.LittleEndian.PutUint16(ifd[4:], 2)
+	binary.LittleEndian.PutUint32(ifd[6:], uint32(len(value)))
+	binary.LittleEndian.PutUint32(ifd[10:], uint32(len(tiff)+len(ifd)))
+	tiff = append(append(tiff, ifd...), value...)
+
+	chunk := []byte("EXIF\x00\x00\x00\x00")
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(tiff)))
+	chunk = append(chunk, tiff...)
+	if len(tiff)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	webp := []byte("RIFF\x00\x00\x00\x00WEBP")
+	webp = append(webp, chunk...)
+	binary.LittleEndian.PutUint32(webp[4:], uint32(len(webp)-8))
+
+	md, err := metadata.Read(webp)
+	if err != nil {
+		t.Fatalf("读取元数据失败: %v", err)
+	}
+	node, _ := md.Prompt["1"].(map[string]interface{})
+	if node["class_type"] != "SaveAnimatedWEBP" {
+		t.Errorf("prompt 解析不正确: %v", md.Prompt)
+	}
+}
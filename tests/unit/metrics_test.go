@@ -0,0 +1,236 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+)
+
+// TestPrometheusMetricsRender 测试 Prometheus 文本格式输出
+func TestPrometheusMetricsRender(t *testing.T) {
+	m := comfyui2go.NewPrometheusMetrics("", []float64{1, 5})
+	m.PromptSubmitted("http://a")
+	m.PromptSubmitted("http://a")
+	m.PromptFinished("http://a", "error")
+	m.NodeDuration("http://a", "KSampler", 2*time.Second)
+	m.QueueDepth("http://a", 1, 3)
+
+	out := m.Render()
+	for _, want := range []string{
+		"# TYPE comfyui_prompts_submitted_total counter\n",
+		`comfyui_prompts_submitted_total{server="http://a"} 2`,
+		`comfyui_prompts_finished_total{server="http://a",status="error"} 1`,
+		"# TYPE comfyui_node_execution_seconds histogram\n",
+		`comfyui_node_execution_seconds_bucket{server="http://a",class_type="KSampler",le="1"} 0`,
+		`comfyui_node_execution_seconds_bucket{server="http://a",class_type="KSampler",le="5"} 1`,
+		`comfyui_node_execution_seconds_bucket{server="http://a",class_type="KSampler",le="+Inf"} 1`,
+		`comfyui_node_execution_seconds_sum{server="http://a",class_type="KSampler"} 2`,
+		`comfyui_queue_depth{server="http://a",state="pending"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出缺少 %q\n%s", want, out)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+// TestClientMetrics 测试提交、执行事件、队列与下载产生的指标
+func TestClientMetrics(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		conn *websocket.Conn
+	)
+	send := func(typ string, data map[string]interface{}) {
+		msg, _ := json.Marshal(map[string]interface{}{"type": typ, "data": data})
+		mu.Lock()
+		c := conn
+		mu.Unlock()
+		c.Write(context.Background(), websocket.MessageText, msg)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"prompt_id": "p1", "number": 1, "node_errors": map[string]interface{}{}})
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			send("execution_start", map[string]interface{}{"prompt_id": "p1"})
+			send("executing", map[string]interface{}{"prompt_id": "p1", "node": "3"})
+			time.Sleep(10 * time.Millisecond)
+			send("execution_success", map[string]interface{}{"prompt_id": "p1"})
+			send("executing", map[string]interface{}{"prompt_id": "p1", "node": nil})
+		}()
+	})
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"queue_running": []interface{}{[]interface{}{0, "p0"}}, "queue_pending": []interface{}{}})
+	})
+	mux.HandleFunc("/view", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "0123456789")
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		conn = c
+		mu.Unlock()
+		for {
+			if _, _, err := c.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	m := comfyui2go.NewPrometheusMetrics("test", nil)
+	client := comfyui2go.NewClientWithOptions("metrics-test", srv.URL, comfyui2go.WithMetrics(m))
+	defer client.CloseWebSocket()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	workflow := comfyui2go.JSON{"3": map[string]interface{}{"class_type": "KSampler", "inputs": map[string]interface{}{}}}
+	if _, err := client.Prompt(ctx, workflow); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	if _, err := client.GetQueue(ctx); err != nil {
+		t.Fatalf("GetQueue 失败: %v", err)
+	}
+	if _, err := client.Download(ctx, "a.png", "", "output"); err != nil {
+		t.Fatalf("Download 失败: %v", err)
+	}
+
+	finished := `test_prompts_finished_total{server="` + srv.URL + `",status="success"} 1`
+	var out string
+	for ctx.Err() == nil {
+		out = m.Render()
+		if strings.Contains(out, finished) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	server := `server="` + srv.URL + `"`
+	for _, want := range []string{
+		finished,
+		`test_prompts_submitted_total{` + server + `} 1`,
+		`test_prompt_queue_wait_seconds_count{` + server + `} 1`,
+		`test_prompt_execution_seconds_count{` + server + `} 1`,
+		`test_node_execution_seconds_count{` + server + `,class_type="KSampler"} 1`,
+		`test_queue_depth{` + server + `,state="running"} 1`,
+		`test_download_bytes_total{` + server + `} 10`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出缺少 %q\n%s", want, out)
+		}
+	}
+}
+
+// TestClientMetricsSharedSocket 测试首个调用方的 ctx 结束后共享 WebSocket 仍然可用，后续 prompt 的指标照常上报
+func TestClientMetricsSharedSocket(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		conn  *websocket.Conn
+		count int
+	)
+	send := func(typ string, data map[string]interface{}) {
+		msg, _ := json.Marshal(map[string]interface{}{"type": typ, "data": data})
+		mu.Lock()
+		c := conn
+		mu.Unlock()
+		c.Write(context.Background(), websocket.MessageText, msg)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		count++
+		id := fmt.Sprintf("p%d", count)
+		mu.Unlock()
+		writeJSON(w, map[string]interface{}{"prompt_id": id, "number": count, "node_errors": map[string]interface{}{}})
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			send("execution_start", map[string]interface{}{"prompt_id": id})
+			send("executing", map[string]interface{}{"prompt_id": id, "node": "3"})
+			time.Sleep(10 * time.Millisecond)
+			send("execution_success", map[string]interface{}{"prompt_id": id})
+			send("executing", map[string]interface{}{"prompt_id": id, "node": nil})
+		}()
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		conn = c
+		mu.Unlock()
+		for {
+			if _, _, err := c.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	m := comfyui2go.NewPrometheusMetrics("test", nil)
+	client := comfyui2go.NewClientWithOptions("metrics-test", srv.URL, comfyui2go.WithMetrics(m))
+	defer client.CloseWebSocket()
+	workflow := comfyui2go.JSON{"3": map[string]interface{}{"class_type": "KSampler", "inputs": map[string]interface{}{}}}
+	server := `server="` + srv.URL + `"`
+
+	// 首个调用方的 ctx 在提交后立即结束
+	first, cancelFirst := context.WithTimeout(context.Background(), 5*time.Second)
+	if _, err := client.Prompt(first, workflow); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	cancelFirst()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	waitFor := func(want string) string {
+		var out string
+		for ctx.Err() == nil {
+			out = m.Render()
+			if strings.Contains(out, want) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return out
+	}
+	waitFor(`test_prompts_finished_total{` + server + `,status="success"} 1`)
+	if !client.IsWebSocketConnected() {
+		t.Fatal("首个调用方的 ctx 结束后 WebSocket 不应断开")
+	}
+
+	if _, err := client.Prompt(ctx, workflow); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	out := waitFor(`test_prompts_finished_total{` + server + `,status="success"} 2`)
+	for _, want := range []string{
+		`test_prompts_finished_total{` + server + `,status="success"} 2`,
+		`test_prompt_queue_wait_seconds_count{` + server + `} 2`,
+		`test_prompt_execution_seconds_count{` + server + `} 2`,
+		`test_node_execution_seconds_count{` + server + `,class_type="KSampler"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("输出缺少 %q\n%s", want, out)
+		}
+	}
+}
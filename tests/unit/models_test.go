@@ -0,0 +1,61 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// TestModelAPIs 测试模型目录、模型文件、嵌入和 safetensors 元数据接口
+func TestModelAPIs(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/models", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []string{"checkpoints", "loras", "vae"})
+	})
+	mux.HandleFunc("/models/loras", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []string{"style.safetensors", "sub/detail.safetensors"})
+	})
+	mux.HandleFunc("/embeddings", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []string{"easynegative"})
+	})
+	mux.HandleFunc("/view_metadata/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/view_metadata/") != "loras" || r.URL.Query().Get("filename") != "style.safetensors" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]interface{}{"ss_base_model_version": "sdxl_base_v1-0"})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	client := comfyui2go.NewClientWithOptions("models-test", srv.URL, comfyui2go.WithoutWebSocket())
+
+	folders, err := client.GetModelFolders(ctx)
+	if err != nil || len(folders) != 3 {
+		t.Errorf("GetModelFolders = %v, %v", folders, err)
+	}
+	loras, err := client.GetModels(ctx, "loras")
+	if err != nil || len(loras) != 2 || loras[1] != "sub/detail.safetensors" {
+		t.Errorf("GetModels = %v, %v", loras, err)
+	}
+	embeddings, err := client.GetEmbeddings(ctx)
+	if err != nil || len(embeddings) != 1 {
+		t.Errorf("GetEmbeddings = %v, %v", embeddings, err)
+	}
+
+	meta, err := client.GetModelMetadata(ctx, "loras", "style.safetensors")
+	if err != nil {
+		t.Fatalf("GetModelMetadata 失败: %v", err)
+	}
+	if meta["ss_base_model_version"] != "sdxl_base_v1-0" {
+		t.Errorf("元数据解析不正确: %v", meta)
+	}
+	if _, err := client.GetModelMetadata(ctx, "loras", "missing.safetensors"); err == nil {
+		t.Error("不存在的文件应返回错误")
+	}
+}
@@ -0,0 +1,66 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+)
+
+// TestPathPrefix 测试反向代理路径前缀与 /api 命名空间同时作用于 HTTP 和 WebSocket
+func TestPathPrefix(t *testing.T) {
+	wsClientID := make(chan string, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/comfy/api/prompt", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"prompt_id": "p1", "number": 1})
+	})
+	mux.HandleFunc("/comfy/internal/logs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, "ok\n")
+	})
+	mux.HandleFunc("/comfy/api/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		wsClientID <- r.URL.Query().Get("clientId")
+		conn.Read(context.Background())
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for name, client := range map[string]*comfyui2go.Client{
+		"WithPathPrefix": comfyui2go.NewClientWithOptions("prefix-test", srv.URL,
+			comfyui2go.WithPathPrefix("comfy/"), comfyui2go.WithAPIPrefix(true)),
+		"baseURL 含路径": comfyui2go.NewClientWithOptions("prefix-test", srv.URL+"/comfy/",
+			comfyui2go.WithAPIPrefix(true)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer client.CloseWebSocket()
+
+			if id, err := client.Prompt(ctx, comfyui2go.JSON{}); err != nil || id != "p1" {
+				t.Errorf("Prompt = %q, %v", id, err)
+			}
+			if text, err := client.GetLogs(ctx); err != nil || text != "ok\n" {
+				t.Errorf("/internal 路由不应带 /api: %q, %v", text, err)
+			}
+			if _, err := client.GetWebSocketClient(ctx); err != nil {
+				t.Fatalf("WebSocket 连接失败: %v", err)
+			}
+			select {
+			case id := <-wsClientID:
+				if id != "prefix-test" {
+					t.Errorf("clientId = %q", id)
+				}
+			case <-ctx.Done():
+				t.Fatal("WebSocket 未连接到带前缀的地址")
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// jpegWithOrientation 生成带 EXIF 方向标记的 JPEG，左上角 8x8 为红色以便检查方向
+func jpegWithOrientation(t *testing.T, w, h int, orientation uint16) []byte {
+	t.Helper()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			src.Set(x, y, color.RGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// TIFF 头（大端）+ IFD0 中唯一的方向条目
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	entry := make([]byte, 12)
+	binary.BigEndian.PutUint16(entry[0:], 0x0112)
+	binary.BigEndian.PutUint16(entry[2:], 3)
+	binary.BigEndian.PutUint32(entry[4:], 1)
+	binary.BigEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(payload)+2))
+	app1 = append(app1, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+// TestPreprocessImage 测试方向校正、缩放对齐、格式转换与蒙版提取
+func TestPreprocessImage(t *testing.T) {
+	t.Run("EXIF方向校正", func(t *testing.T) {
+		data := jpegWithOrientation(t, 40, 20, 6)
+		img, err := comfyui2go.PreprocessImage(bytes.NewReader(data), "phone.jpg", comfyui2go.PreprocessOptions{
+			NormalizeOrientation: true,
+		})
+		if err != nil {
+			t.Fatalf("预处理失败: %v", err)
+		}
+		if img.Width != 20 || img.Height != 40 {
+			t.Errorf("旋转 90° 后尺寸应为 20x40, 实际 %dx%d", img.Width, img.Height)
+		}
+		if img.Filename != "phone.jpg" {
+			t.Errorf("未要求转换格式时应保留文件名: %s", img.Filename)
+		}
+		// 方向 6 表示需顺时针旋转 90°：原图左上角的红块应移到右上角
+		out, err := jpeg.Decode(bytes.NewReader(img.Data))
+		if err != nil {
+			t.Fatalf("输出应为 JPEG: %v", err)
+		}
+		isRed := func(x, y int) bool {
+			r, g, b, _ := out.At(x, y).RGBA()
+			return r > 0xc000 && g < 0x4000 && b < 0x4000
+		}
+		if !isRed(16, 3) || isRed(3, 3) || isRed(3, 36) {
+			t.Errorf("旋转方向不正确：右上角应为红色，左上角与左下角不应为红色")
+		}
+	})
+
+	t.Run("限制尺寸并对齐", func(t *testing.T) {
+		data := jpegWithOrientation(t, 1000, 500, 1)
+		img, err := comfyui2go.PreprocessImage(bytes.NewReader(data), "big.jpg", comfyui2go.PreprocessOptions{
+			MaxDimension: 300,
+			AlignTo:      64,
+			ConvertToPNG: true,
+		})
+		if err != nil {
+			t.Fatalf("预处理失败: %v", err)
+		}
+		if img.Width != 256 || img.Height != 128 {
+			t.Errorf("尺寸应为 256x128, 实际 %dx%d", img.Width, img.Height)
+		}
+		if img.Filename != "big.png" {
+			t.Errorf("转换为 PNG 后文件名应为 big.png, 实际 %s", img.Filename)
+		}
+		if _, err := png.Decode(bytes.NewReader(img.Data)); err != nil {
+			t.Errorf("输出应为 PNG: %v", err)
+		}
+	})
+
+	t.Run("提取alpha蒙版", func(t *testing.T) {
+		src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+		src.Set(0, 0, color.NRGBA{R: 255, A: 255})
+		src.Set(1, 0, color.NRGBA{R: 255, A: 0})
+		var buf bytes.Buffer
+		png.Encode(&buf, src)
+
+		img, err := comfyui2go.PreprocessImage(&buf, "cutout.png", comfyui2go.PreprocessOptions{ExtractMask: true})
+		if err != nil {
+			t.Fatalf("预处理失败: %v", err)
+		}
+		mask, err := png.Decode(bytes.NewReader(img.Mask))
+		if err != nil {
+			t.Fatalf("蒙版应为 PNG: %v", err)
+		}
+		// /upload/mask 读取 alpha 通道：不透明处保持不透明，透明处为需要重绘的区域
+		opaque, clear := maskPixel(mask, 0, 0), maskPixel(mask, 1, 0)
+		if opaque.A != 255 || clear.A != 0 {
+			t.Errorf("alpha 应与原图一致: %v %v", opaque, clear)
+		}
+		// 作为图片供 LoadImageMask 使用时读取颜色通道
+		if opaque.R != 0 || clear.R != 255 {
+			t.Errorf("不透明处应为 0，透明处应为 255: %v %v", opaque, clear)
+		}
+	})
+
+	t.Run("蒙版与缩放后的图片对齐", func(t *testing.T) {
+		// 左半透明、右半不透明，缩小一半后蒙版尺寸和位置应与输出图片一致
+		src := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+		for y := 0; y < 16; y++ {
+			for x := 16; x < 32; x++ {
+				src.Set(x, y, color.NRGBA{B: 255, A: 255})
+			}
+		}
+		var buf bytes.Buffer
+		png.Encode(&buf, src)
+
+		img, err := comfyui2go.PreprocessImage(&buf, "half.png", comfyui2go.PreprocessOptions{MaxDimension: 16, ExtractMask: true})
+		if err != nil {
+			t.Fatalf("预处理失败: %v", err)
+		}
+		mask, err := png.Decode(bytes.NewReader(img.Mask))
+		if err != nil {
+			t.Fatalf("蒙版应为 PNG: %v", err)
+		}
+		if mask.Bounds().Dx() != img.Width || mask.Bounds().Dy() != img.Height {
+			t.Fatalf("蒙版尺寸 %v 与图片 %dx%d 不一致", mask.Bounds(), img.Width, img.Height)
+		}
+		if left, right := maskPixel(mask, 2, 4), maskPixel(mask, 13, 4); left.A != 0 || left.R != 255 || right.A != 255 || right.R != 0 {
+			t.Errorf("蒙版应为左侧透明、右侧不透明: %v %v", left, right)
+		}
+	})
+
+	t.Run("上传时不支持提取蒙版", func(t *testing.T) {
+		client := comfyui2go.NewClientWithOptions("preprocess-test", "http://127.0.0.1:1", comfyui2go.WithoutWebSocket())
+		_, err := client.UploadImage(context.Background(), "cutout.png", bytes.NewReader(nil),
+			comfyui2go.WithPreprocess(comfyui2go.PreprocessOptions{ExtractMask: true}))
+		if err == nil || !strings.Contains(err.Error(), "PreprocessImage") {
+			t.Errorf("期望指向 PreprocessImage 的错误, 实际 %v", err)
+		}
+	})
+}
+
+// maskPixel 以非预乘形式读取蒙版像素
+func maskPixel(img image.Image, x, y int) color.NRGBA {
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+}
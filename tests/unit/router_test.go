@@ -0,0 +1,204 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// newInventoryServer 创建一个只提供 /object_info 和 /models/{folder} 的模拟服务器
+func newInventoryServer(t *testing.T, nodes []string, models map[string][]string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/object_info", func(w http.ResponseWriter, r *http.Request) {
+		info := map[string]interface{}{}
+		for _, n := range nodes {
+			info[n] = map[string]interface{}{"name": n}
+		}
+		writeJSON(w, info)
+	})
+	mux.HandleFunc("/models/", func(w http.ResponseWriter, r *http.Request) {
+		folder := strings.TrimPrefix(r.URL.Path, "/models/")
+		files, ok := models[folder]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, files)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func testWorkflow() comfyui2go.JSON {
+	return comfyui2go.JSON{
+		"1": map[string]interface{}{
+			"class_type": "CheckpointLoaderSimple",
+			"inputs":     map[string]interface{}{"ckpt_name": "sd15.safetensors"},
+		},
+		"2": map[string]interface{}{
+			"class_type": "LoraLoader",
+			"inputs": map[string]interface{}{
+				"lora_name": "style.safetensors",
+				"model":     []interface{}{"1", 0},
+			},
+		},
+		"3": map[string]interface{}{
+			"class_type": "SaveImage",
+			"inputs":     map[string]interface{}{"filename_prefix": "out"},
+		},
+	}
+}
+
+// TestWorkflowRequirements 测试工作流需求分析
+func TestWorkflowRequirements(t *testing.T) {
+	req := comfyui2go.WorkflowRequirements(testWorkflow())
+
+	want := []string{"CheckpointLoaderSimple", "LoraLoader", "SaveImage"}
+	if strings.Join(req.ClassTypes, ",") != strings.Join(want, ",") {
+		t.Errorf("ClassTypes = %v, 期望 %v", req.ClassTypes, want)
+	}
+	if got := req.Models["checkpoints"]; len(got) != 1 || got[0] != "sd15.safetensors" {
+		t.Errorf("checkpoints = %v", got)
+	}
+	if got := req.Models["loras"]; len(got) != 1 || got[0] != "style.safetensors" {
+		t.Errorf("loras = %v", got)
+	}
+	if len(req.Models) != 2 {
+		t.Errorf("不应识别 filename_prefix 等非模型输入: %v", req.Models)
+	}
+}
+
+// TestRouterSelect 测试按能力路由
+func TestRouterSelect(t *testing.T) {
+	ctx := context.Background()
+	nodes := []string{"CheckpointLoaderSimple", "LoraLoader", "SaveImage"}
+
+	full := newInventoryServer(t, nodes, map[string][]string{
+		"checkpoints": {"sd15.safetensors"},
+		"loras":       {"style.safetensors"},
+	})
+	partial := newInventoryServer(t, nodes[:1], map[string][]string{
+		"checkpoints": {"other.safetensors"},
+		"loras":       {},
+	})
+
+	fullClient := comfyui2go.NewClientWithOptions("router", full.URL, comfyui2go.WithoutWebSocket())
+	partialClient := comfyui2go.NewClientWithOptions("router", partial.URL, comfyui2go.WithoutWebSocket())
+	router := comfyui2go.NewRouter([]*comfyui2go.Client{partialClient, fullClient})
+
+	t.Run("选择具备能力的服务器", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			c, err := router.Select(ctx, testWorkflow())
+			if err != nil {
+				t.Fatalf("选择服务器失败: %v", err)
+			}
+			if c != fullClient {
+				t.Fatal("应该选择具备全部节点和模型的服务器")
+			}
+		}
+	})
+
+	t.Run("无可用服务器时列出缺失内容", func(t *testing.T) {
+		wf := testWorkflow()
+		wf["4"] = map[string]interface{}{
+			"class_type": "VAELoader",
+			"inputs":     map[string]interface{}{"vae_name": "missing.safetensors"},
+		}
+
+		_, err := router.Select(ctx, wf)
+		if !errors.Is(err, comfyui2go.ErrNoEligibleServer) {
+			t.Fatalf("期望 ErrNoEligibleServer, 实际: %v", err)
+		}
+		var noneErr *comfyui2go.NoEligibleServerError
+		if !errors.As(err, &noneErr) {
+			t.Fatalf("期望 *NoEligibleServerError, 实际: %T", err)
+		}
+		if got := noneErr.Missing[full.URL].Models["vae"]; len(got) != 1 || got[0] != "missing.safetensors" {
+			t.Errorf("应列出缺失的 vae 模型: %v", err)
+		}
+		miss := noneErr.Missing[partial.URL]
+		if len(miss.ClassTypes) == 0 || miss.Models["checkpoints"][0] != "sd15.safetensors" {
+			t.Errorf("缺失内容不完整: %v", err)
+		}
+		t.Logf("✅ 错误信息: %v", err)
+	})
+}
+
+// TestRouterModelFolders 测试旧目录名与拉取目录失败的处理
+func TestRouterModelFolders(t *testing.T) {
+	ctx := context.Background()
+	wf := comfyui2go.JSON{
+		"1": map[string]interface{}{
+			"class_type": "CLIPLoader",
+			"inputs":     map[string]interface{}{"clip_name": "t5xxl.safetensors"},
+		},
+	}
+
+	t.Run("旧版本服务器的 clip 目录", func(t *testing.T) {
+		var mu sync.Mutex
+		requests := map[string]int{}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/object_info", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"CLIPLoader": map[string]interface{}{}})
+		})
+		mux.HandleFunc("/models/", func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			requests[r.URL.Path]++
+			mu.Unlock()
+			if r.URL.Path == "/models/clip" {
+				writeJSON(w, []string{"t5xxl.safetensors"})
+				return
+			}
+			http.NotFound(w, r)
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		client := comfyui2go.NewClientWithOptions("router", srv.URL, comfyui2go.WithoutWebSocket())
+		router := comfyui2go.NewRouter([]*comfyui2go.Client{client})
+		for i := 0; i < 2; i++ {
+			if _, err := router.Select(ctx, wf); err != nil {
+				t.Fatalf("clip 目录中的模型应被识别: %v", err)
+			}
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if requests["/models/text_encoders"] != 1 || requests["/models/clip"] != 1 {
+			t.Errorf("不存在的目录应被缓存: %v", requests)
+		}
+	})
+
+	t.Run("拉取目录失败", func(t *testing.T) {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/object_info", func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, map[string]interface{}{"CLIPLoader": map[string]interface{}{}})
+		})
+		mux.HandleFunc("/models/", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		client := comfyui2go.NewClientWithOptions("router", srv.URL, comfyui2go.WithoutWebSocket())
+		router := comfyui2go.NewRouter([]*comfyui2go.Client{client})
+		_, err := router.Select(ctx, wf)
+		var noneErr *comfyui2go.NoEligibleServerError
+		if !errors.As(err, &noneErr) || noneErr.Unreachable[srv.URL] == nil || len(noneErr.Missing) != 0 {
+			t.Fatalf("拉取失败应记为不可达而不是缺少模型: %v", err)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deferz/comfyui2go"
+)
+
+func outputImage(name, typ string) map[string]interface{} {
+	return map[string]interface{}{"filename": name, "subfolder": "", "type": typ}
+}
+
+// TestRunStreamsOutputs 测试节点执行完成后立即投递输出，并在结束时补投历史记录中的输出
+func TestRunStreamsOutputs(t *testing.T) {
+	f := newFakeComfyServer(t)
+	f.hang["r1"] = true
+	client := comfyui2go.NewClientWithOptions("run-test", f.URL)
+	defer client.CloseWebSocket()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	run, err := client.Run(ctx, markerWorkflow("r1"), comfyui2go.WithOutputTypes("output"))
+	if err != nil {
+		t.Fatalf("Run 失败: %v", err)
+	}
+	if run.PromptID() != "p-r1" {
+		t.Fatalf("PromptID = %q", run.PromptID())
+	}
+	outputs := run.Outputs()
+
+	f.send(t, "execution_start", map[string]interface{}{"prompt_id": "p-r1"})
+	f.send(t, "executing", map[string]interface{}{"prompt_id": "p-r1", "node": "9"})
+	f.send(t, "progress", map[string]interface{}{"node": "9", "value": 1, "max": 2})
+	f.send(t, "executed", map[string]interface{}{"prompt_id": "p-r1", "node": "9", "output": map[string]interface{}{
+		"images": []interface{}{outputImage("a.png", "output"), outputImage("preview.png", "temp")},
+	}})
+	f.send(t, "executed", map[string]interface{}{"prompt_id": "other", "node": "9", "output": map[string]interface{}{
+		"images": []interface{}{outputImage("other.png", "output")},
+	}})
+
+	// 任务尚未结束时即可收到第一个输出
+	select {
+	case a := <-outputs:
+		if a.NodeID != "9" || a.Kind != "images" || a.Filename != "a.png" {
+			t.Errorf("输出 = %+v", a)
+		}
+	case <-ctx.Done():
+		t.Fatal("未收到节点输出")
+	}
+	select {
+	case <-run.Done():
+		t.Fatal("任务尚未结束")
+	default:
+	}
+
+	f.complete("r1", map[string]interface{}{
+		"status": map[string]interface{}{"status_str": "success", "completed": true},
+		"outputs": map[string]interface{}{
+			"9":  map[string]interface{}{"images": []interface{}{outputImage("a.png", "output")}},
+			"12": map[string]interface{}{"images": []interface{}{outputImage("b.png", "output")}},
+		},
+	})
+	f.send(t, "execution_success", map[string]interface{}{"prompt_id": "p-r1"})
+
+	var rest []string
+	for a := range outputs {
+		rest = append(rest, a.Filename)
+	}
+	if len(rest) != 1 || rest[0] != "b.png" {
+		t.Errorf("补投输出 = %v", rest)
+	}
+	res, err := run.Wait(ctx)
+	if err != nil || res == nil || res.PromptID != "p-r1" {
+		t.Fatalf("Wait = %+v, %v", res, err)
+	}
+
+	var types []string
+	var progress *comfyui2go.WSProgressMessage
+	var executed []comfyui2go.OutputAsset
+	for ev := range run.Events() {
+		if ev.PromptID != "p-r1" {
+			t.Errorf("事件 prompt_id = %q", ev.PromptID)
+		}
+		types = append(types, ev.Type)
+		switch ev.Type {
+		case "progress":
+			progress = ev.Progress
+		case "executed":
+			executed = ev.Outputs
+		}
+	}
+	want := []string{"execution_start", "executing", "progress", "executed", "execution_success"}
+	if len(types) != len(want) {
+		t.Fatalf("事件 = %v", types)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("事件 = %v", types)
+		}
+	}
+	if progress == nil || progress.Value != 1 || progress.Max != 2 {
+		t.Errorf("Progress = %+v", progress)
+	}
+	if len(executed) != 2 {
+		t.Errorf("executed 事件的输出应包含全部类型: %+v", executed)
+	}
+}
+
+// TestRunCancel 测试取消执行中的任务
+func TestRunCancel(t *testing.T) {
+	f := newFakeComfyServer(t)
+	f.hang["r1"] = true
+	client := comfyui2go.NewClientWithOptions("run-test", f.URL)
+	defer client.CloseWebSocket()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	run, err := client.Run(ctx, markerWorkflow("r1"))
+	if err != nil {
+		t.Fatalf("Run 失败: %v", err)
+	}
+	if err := run.Cancel(ctx); err != nil {
+		t.Fatalf("Cancel 失败: %v", err)
+	}
+	if _, err := run.Wait(ctx); !errors.Is(err, comfyui2go.ErrRunCancelled) {
+		t.Fatalf("Wait 错误 = %v", err)
+	}
+	f.mu.Lock()
+	interrupted := len(f.interrupted) > 0
+	f.mu.Unlock()
+	if !interrupted {
+		t.Error("未调用 /interrupt")
+	}
+	for range run.Outputs() {
+		t.Error("取消后不应有输出")
+	}
+}
+
+// TestRunPromptError 测试提交失败时直接返回错误
+func TestRunPromptError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": "invalid prompt"}`, http.StatusBadRequest)
+	}))
+	defer srv.Close()
+	client := comfyui2go.NewClientWithOptions("run-test", srv.URL, comfyui2go.WithoutWebSocket())
+	run, err := client.Run(context.Background(), comfyui2go.JSON{})
+	if err == nil || run != nil {
+		t.Fatalf("Run = %v, %v", run, err)
+	}
+}
@@ -0,0 +1,49 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// TestGetSystemStats 测试 /system_stats 解析
+func TestGetSystemStats(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/system_stats" {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, map[string]interface{}{
+			"system": map[string]interface{}{
+				"os": "posix", "python_version": "3.11.9", "comfyui_version": "0.3.40",
+				"embedded_python": false, "ram_total": 68719476736, "ram_free": 34359738368,
+			},
+			"devices": []interface{}{
+				map[string]interface{}{"name": "cuda:0 NVIDIA GeForce RTX 4090", "type": "cuda", "index": 0,
+					"vram_total": 25757220864, "vram_free": 21474836480,
+					"torch_vram_total": 2147483648, "torch_vram_free": 1073741824},
+				map[string]interface{}{"name": "cuda:1", "type": "cuda", "index": 1,
+					"vram_total": 25757220864, "vram_free": 1073741824},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	client := comfyui2go.NewClientWithOptions("stats-test", srv.URL, comfyui2go.WithoutWebSocket())
+	stats, err := client.GetSystemStats(context.Background())
+	if err != nil {
+		t.Fatalf("获取系统信息失败: %v", err)
+	}
+	if stats.System.ComfyUIVersion != "0.3.40" || stats.System.RAMTotal != 68719476736 {
+		t.Errorf("系统信息解析不正确: %+v", stats.System)
+	}
+	if len(stats.Devices) != 2 || stats.Devices[0].Type != "cuda" || *stats.Devices[1].Index != 1 {
+		t.Errorf("设备信息解析不正确: %+v", stats.Devices)
+	}
+	if got := stats.MaxVRAMFree(); got != 21474836480 {
+		t.Errorf("MaxVRAMFree = %d", got)
+	}
+}
@@ -0,0 +1,143 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+)
+
+// historyWithMessages 为服务器 /history 返回的真实结构
+const historyWithMessages = `{
+  "p1": {
+    "prompt": [3, "p1", {"3": {"class_type": "KSampler", "inputs": {}}, "9": {"class_type": "SaveImage", "inputs": {}}}, {}, ["9"]],
+    "outputs": {},
+    "status": {
+      "status_str": "error",
+      "completed": false,
+      "messages": [
+        ["execution_start", {"prompt_id": "p1", "timestamp": 1700000000000}],
+        ["execution_cached", {"nodes": ["4", "5"], "prompt_id": "p1", "timestamp": 1700000000010}],
+        ["execution_error", {"prompt_id": "p1", "node_id": "9", "node_type": "SaveImage", "executed": ["3"],
+          "exception_message": "disk full\n", "exception_type": "OSError",
+          "traceback": ["  File \"nodes.py\", line 1\n"], "current_inputs": {}, "current_outputs": {},
+          "timestamp": 1700000002500}],
+        "malformed"
+      ]
+    }
+  }
+}`
+
+// TestTimelineFromHistory 测试历史消息解析与时间线
+func TestTimelineFromHistory(t *testing.T) {
+	var h comfyui2go.HistoryResponse
+	if err := json.Unmarshal([]byte(historyWithMessages), &h); err != nil {
+		t.Fatalf("解析历史失败: %v", err)
+	}
+	item := h["p1"]
+	msgs := item.Status.Messages
+	if len(msgs) != 4 || msgs[1].Event != "execution_cached" || msgs[3].Event != "" {
+		t.Fatalf("消息解析不正确: %+v", msgs)
+	}
+	if !msgs[0].Timestamp().Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("Timestamp = %v", msgs[0].Timestamp())
+	}
+	encoded, _ := json.Marshal(msgs[0])
+	if string(encoded) != `["execution_start",{"prompt_id":"p1","timestamp":1700000000000}]` {
+		t.Errorf("编码 = %s", encoded)
+	}
+
+	tl := comfyui2go.TimelineFromHistory("p1", item)
+	if tl.Status != "error" || tl.Duration() != 2500*time.Millisecond {
+		t.Errorf("Status=%s Duration=%v", tl.Status, tl.Duration())
+	}
+	if !reflect.DeepEqual(tl.Cached, []string{"4", "5"}) {
+		t.Errorf("Cached = %v", tl.Cached)
+	}
+	e := tl.Error
+	if e == nil || e.NodeID != "9" || e.NodeType != "SaveImage" || e.ExceptionType != "OSError" ||
+		len(e.Traceback) != 1 || !reflect.DeepEqual(e.Executed, []string{"3"}) {
+		t.Fatalf("Error = %+v", e)
+	}
+	if e.Error() != "prompt p1 failed at node 9 (SaveImage): OSError: disk full" {
+		t.Errorf("Error() = %q", e.Error())
+	}
+}
+
+// TestWatchTimeline 测试从 WebSocket 事件构建逐节点时间线
+func TestWatchTimeline(t *testing.T) {
+	connected := make(chan *websocket.Conn, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		connected <- c
+		for {
+			if _, _, err := c.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := comfyui2go.NewClientWithOptions("timeline-test", srv.URL)
+	defer client.CloseWebSocket()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	workflow := comfyui2go.JSON{
+		"3": map[string]interface{}{"class_type": "KSampler"},
+		"9": map[string]interface{}{"class_type": "SaveImage"},
+	}
+	b, err := client.WatchTimeline(ctx, "p1", workflow)
+	if err != nil {
+		t.Fatalf("WatchTimeline 失败: %v", err)
+	}
+	conn := <-connected
+
+	var mu sync.Mutex
+	send := func(typ string, data map[string]interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		msg, _ := json.Marshal(map[string]interface{}{"type": typ, "data": data})
+		conn.Write(ctx, websocket.MessageText, msg)
+	}
+	send("execution_start", map[string]interface{}{"prompt_id": "p1"})
+	send("execution_cached", map[string]interface{}{"prompt_id": "p1", "nodes": []interface{}{"4"}})
+	send("executing", map[string]interface{}{"prompt_id": "p1", "node": "3"})
+	time.Sleep(50 * time.Millisecond)
+	send("executing", map[string]interface{}{"prompt_id": "other", "node": "1"})
+	send("executing", map[string]interface{}{"prompt_id": "p1", "node": "9"})
+	send("execution_success", map[string]interface{}{"prompt_id": "p1"})
+	send("executing", map[string]interface{}{"prompt_id": "p1", "node": nil})
+
+	select {
+	case <-b.Done():
+	case <-ctx.Done():
+		t.Fatal("时间线未结束")
+	}
+	tl := b.Timeline()
+	if tl.Status != "success" || tl.Error != nil || !reflect.DeepEqual(tl.Cached, []string{"4"}) {
+		t.Errorf("时间线 = %+v", tl)
+	}
+	if len(tl.Nodes) != 2 || tl.Nodes[0].ClassType != "KSampler" || tl.Nodes[1].NodeID != "9" {
+		t.Fatalf("Nodes = %+v", tl.Nodes)
+	}
+	slowest, ok := tl.Slowest()
+	if !ok || slowest.NodeID != "3" || slowest.Duration() < 50*time.Millisecond {
+		t.Errorf("Slowest = %+v", slowest)
+	}
+	if tl.Duration() < slowest.Duration() {
+		t.Errorf("总耗时 %v 小于节点耗时 %v", tl.Duration(), slowest.Duration())
+	}
+}
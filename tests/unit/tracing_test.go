@@ -0,0 +1,233 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+)
+
+// recordedSpan 为测试记录的 span
+type recordedSpan struct {
+	tracer *recordingTracer
+	name   string
+	parent *recordedSpan
+	id     byte
+	attrs  map[string]interface{}
+	events []string
+	ended  int
+	err    error
+}
+
+func (s *recordedSpan) SetAttributes(attrs ...comfyui2go.Attribute) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *recordedSpan) AddEvent(name string, _ ...comfyui2go.Attribute) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.events = append(s.events, name)
+}
+
+func (s *recordedSpan) End(err error) {
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.ended++
+	s.err = err
+}
+
+func (s *recordedSpan) TraceParent() string {
+	return comfyui2go.FormatTraceParent([16]byte{0: 0xab, 15: 0xcd}, [8]byte{7: s.id}, true)
+}
+
+type spanKey struct{}
+
+// recordingTracer 记录创建的全部 span
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, attrs ...comfyui2go.Attribute) (context.Context, comfyui2go.Span) {
+	t.mu.Lock()
+	parent, _ := ctx.Value(spanKey{}).(*recordedSpan)
+	s := &recordedSpan{tracer: t, name: name, parent: parent, id: byte(len(t.spans) + 1), attrs: map[string]interface{}{}}
+	t.spans = append(t.spans, s)
+	t.mu.Unlock()
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *recordingTracer) find(name string) []*recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []*recordedSpan
+	for _, s := range t.spans {
+		if s.name == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// TestTracing 测试 HTTP 请求与 prompt 生命周期的 span 以及 traceparent 注入
+func TestTracing(t *testing.T) {
+	var (
+		mu           sync.Mutex
+		conn         *websocket.Conn
+		traceparents []string
+	)
+	send := func(typ string, data map[string]interface{}) {
+		msg, _ := json.Marshal(map[string]interface{}{"type": typ, "data": data})
+		mu.Lock()
+		c := conn
+		mu.Unlock()
+		c.Write(context.Background(), websocket.MessageText, msg)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/prompt", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mu.Unlock()
+		writeJSON(w, map[string]interface{}{"prompt_id": "p1", "number": 7, "node_errors": map[string]interface{}{}})
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			send("execution_start", map[string]interface{}{"prompt_id": "p1"})
+			send("execution_cached", map[string]interface{}{"prompt_id": "p1", "nodes": []interface{}{"4"}})
+			send("executing", map[string]interface{}{"prompt_id": "p1", "node": "3"})
+			send("executing", map[string]interface{}{"prompt_id": "p1", "node": "9"})
+			send("execution_error", map[string]interface{}{
+				"prompt_id": "p1", "node_id": "9", "node_type": "SaveImage", "exception_message": "disk full",
+			})
+		}()
+	})
+	mux.HandleFunc("/history/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mu.Unlock()
+		c, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		conn = c
+		mu.Unlock()
+		for {
+			if _, _, err := c.Read(context.Background()); err != nil {
+				return
+			}
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tracer := &recordingTracer{}
+	client := comfyui2go.NewClientWithOptions("tracing-test", srv.URL, comfyui2go.WithTracer(tracer))
+	defer client.CloseWebSocket()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	parentCtx, parent := tracer.Start(ctx, "caller")
+	workflow := comfyui2go.JSON{
+		"3": map[string]interface{}{"class_type": "KSampler", "inputs": map[string]interface{}{}},
+		"9": map[string]interface{}{"class_type": "SaveImage", "inputs": map[string]interface{}{}},
+	}
+	if _, err := client.Prompt(parentCtx, workflow); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	if _, err := client.GetHistory(ctx, "missing"); err == nil {
+		t.Fatal("期望 404 返回错误")
+	}
+
+	prompts := tracer.find("comfyui.prompt")
+	if len(prompts) != 1 {
+		t.Fatalf("prompt span 数量 = %d", len(prompts))
+	}
+	prompt := prompts[0]
+	for ctx.Err() == nil {
+		tracer.mu.Lock()
+		ended := prompt.ended
+		tracer.mu.Unlock()
+		if ended > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	if prompt.parent != parent.(*recordedSpan) || prompt.ended != 1 {
+		t.Errorf("prompt span parent=%v ended=%d", prompt.parent, prompt.ended)
+	}
+	if prompt.attrs["comfyui.prompt_id"] != "p1" || prompt.attrs["comfyui.prompt.status"] != "error" {
+		t.Errorf("prompt span 属性 = %v", prompt.attrs)
+	}
+	if got := strings.Join(prompt.events, ","); got != "queued,execution_start,execution_cached" {
+		t.Errorf("prompt span 事件 = %s", got)
+	}
+	if prompt.err == nil || !strings.Contains(prompt.err.Error(), "SaveImage") || !strings.Contains(prompt.err.Error(), "disk full") {
+		t.Errorf("prompt span 错误 = %v", prompt.err)
+	}
+
+	var nodes, https []string
+	for _, s := range tracer.spans {
+		switch s.name {
+		case "comfyui.node":
+			if s.parent != prompt || s.ended != 1 {
+				t.Errorf("node span parent=%v ended=%d", s.parent, s.ended)
+			}
+			nodes = append(nodes, fmt.Sprint(s.attrs["comfyui.node.id"], "/", s.attrs["comfyui.node.class_type"]))
+		case "comfyui.http":
+			if s.ended != 1 {
+				t.Errorf("http span %v ended=%d", s.attrs, s.ended)
+			}
+			https = append(https, fmt.Sprint(s.attrs["http.request.method"], " ", s.attrs["url.path"], " ", s.attrs["http.response.status_code"], " ", s.err != nil))
+			if s.attrs["url.path"] == "/prompt" && s.parent != prompt {
+				t.Errorf("/prompt span 的父 span 应为 prompt span")
+			}
+		}
+	}
+	if got := strings.Join(nodes, ","); got != "3/KSampler,9/SaveImage" {
+		t.Errorf("node spans = %s", got)
+	}
+	if got := strings.Join(https, ","); got != "GET /api/system_stats 404 true,GET /system_stats 404 true,POST /prompt 200 false,GET /history/missing 404 true" {
+		t.Errorf("http spans = %s", got)
+	}
+
+	connects := 0
+	for _, s := range tracer.spans {
+		if s.name == "comfyui.websocket.connect" {
+			connects++
+		}
+	}
+	if connects != 1 {
+		t.Errorf("websocket connect span 数量 = %d", connects)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(traceparents) != 2 {
+		t.Fatalf("traceparent = %v", traceparents)
+	}
+	for _, tp := range traceparents {
+		if !strings.HasPrefix(tp, "00-ab0000000000000000000000000000cd-") || !strings.HasSuffix(tp, "-01") {
+			t.Errorf("traceparent 格式不正确: %q", tp)
+		}
+	}
+}
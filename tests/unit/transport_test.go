@@ -0,0 +1,128 @@
+package unit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+)
+
+// queueAndWSHandler 提供 /queue 与 /ws，用于验证 HTTP 与 WebSocket 走同一传输层
+func queueAndWSHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]interface{}{"queue_running": []interface{}{}, "queue_pending": []interface{}{}})
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Accept(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn.Read(context.Background())
+	})
+	return mux
+}
+
+// TestTLSOptions 测试自定义 CA 与客户端证书同时作用于 HTTP 和 WebSocket
+func TestTLSOptions(t *testing.T) {
+	srv := httptest.NewUnstartedServer(queueAndWSHandler())
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // 屏蔽预期内的握手失败日志
+	srv.StartTLS()
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	clientCert := srv.TLS.Certificates[0]
+
+	t.Run("CA 与客户端证书", func(t *testing.T) {
+		client := comfyui2go.NewClientWithOptions("tls-test", srv.URL,
+			comfyui2go.WithRootCAs(pool),
+			comfyui2go.WithClientCertificates(clientCert),
+		)
+		defer client.CloseWebSocket()
+		if _, err := client.GetQueue(ctx); err != nil {
+			t.Errorf("HTTP 请求失败: %v", err)
+		}
+		if _, err := client.GetWebSocketClient(ctx); err != nil {
+			t.Errorf("WebSocket 连接失败: %v", err)
+		}
+	})
+
+	t.Run("缺少客户端证书", func(t *testing.T) {
+		client := comfyui2go.NewClientWithOptions("tls-test", srv.URL, comfyui2go.WithRootCAs(pool))
+		defer client.CloseWebSocket()
+		if _, err := client.GetQueue(ctx); err == nil {
+			t.Error("未提供客户端证书时 HTTP 请求应失败")
+		}
+		if _, err := client.GetWebSocketClient(ctx); err == nil {
+			t.Error("未提供客户端证书时 WebSocket 连接应失败")
+		}
+	})
+
+	t.Run("跳过校验", func(t *testing.T) {
+		client := comfyui2go.NewClientWithOptions("tls-test", srv.URL,
+			comfyui2go.WithInsecureSkipVerify(),
+			comfyui2go.WithClientCertificates(clientCert),
+		)
+		defer client.CloseWebSocket()
+		if _, err := client.GetWebSocketClient(ctx); err != nil {
+			t.Errorf("WebSocket 连接失败: %v", err)
+		}
+	})
+}
+
+// TestProxyOption 测试 HTTP 请求与 WebSocket 握手都经过代理
+func TestProxyOption(t *testing.T) {
+	backend := httptest.NewServer(queueAndWSHandler())
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	var mu sync.Mutex
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		proxied = append(proxied, r.URL.Path)
+		mu.Unlock()
+		httputil.NewSingleHostReverseProxy(target).ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client := comfyui2go.NewClientWithOptions("proxy-test", backend.URL, comfyui2go.WithProxy(proxy.URL))
+	defer client.CloseWebSocket()
+	if _, err := client.GetQueue(ctx); err != nil {
+		t.Fatalf("HTTP 请求失败: %v", err)
+	}
+	if _, err := client.GetWebSocketClient(ctx); err != nil {
+		t.Fatalf("WebSocket 连接失败: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 连接 WebSocket 前的能力探测同样经过代理
+	if len(proxied) < 2 || proxied[0] != "/queue" || proxied[len(proxied)-1] != "/ws" {
+		t.Errorf("经过代理的请求 = %v", proxied)
+	}
+
+	bad := comfyui2go.NewClientWithOptions("proxy-test", backend.URL, comfyui2go.WithProxy("://bad"), comfyui2go.WithoutWebSocket())
+	if _, err := bad.GetQueue(ctx); err == nil {
+		t.Error("无效的代理地址应返回错误")
+	}
+}
@@ -0,0 +1,165 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// fakeUploadServer 模拟 /upload/image 与 /view 的输入目录
+type fakeUploadServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	files   map[string][]byte   // subfolder/name -> 内容
+	forms   []map[string]string // 每次上传的表单字段
+	uploads int
+}
+
+func newFakeUploadServer(t *testing.T) *fakeUploadServer {
+	t.Helper()
+	f := &fakeUploadServer{files: map[string][]byte{}}
+	mux := http.NewServeMux()
+	upload := func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("image")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		form := map[string]string{}
+		for k, v := range r.MultipartForm.Value {
+			form[k] = v[0]
+		}
+		typ := form["type"]
+		if typ == "" {
+			typ = "input"
+		}
+
+		f.mu.Lock()
+		f.uploads++
+		f.forms = append(f.forms, form)
+		f.files[form["subfolder"]+"/"+header.Filename] = data
+		f.mu.Unlock()
+		writeJSON(w, map[string]string{"name": header.Filename, "subfolder": form["subfolder"], "type": typ})
+	}
+	mux.HandleFunc("/upload/image", upload)
+	mux.HandleFunc("/upload/mask", upload)
+	mux.HandleFunc("/view", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		f.mu.Lock()
+		data, ok := f.files[q.Get("subfolder")+"/"+q.Get("filename")]
+		f.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Server.Close)
+	return f
+}
+
+func (f *fakeUploadServer) uploadCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.uploads
+}
+
+// TestUploadDedup 测试内容寻址上传去重
+func TestUploadDedup(t *testing.T) {
+	srv := newFakeUploadServer(t)
+	ctx := context.Background()
+	content := []byte("reference image bytes")
+	want := comfyui2go.ContentAddressedName("ref.PNG", content)
+	if !strings.HasSuffix(want, ".png") {
+		t.Fatalf("文件名应保留小写扩展名: %s", want)
+	}
+
+	client := comfyui2go.NewClientWithOptions("upload-test", srv.URL,
+		comfyui2go.WithoutWebSocket(),
+		comfyui2go.WithUploadDedup(true),
+	)
+	for i := 0; i < 3; i++ {
+		resp, err := client.UploadImage(ctx, "ref.PNG", bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("上传失败: %v", err)
+		}
+		if resp.Name != want || resp.Type != "input" {
+			t.Errorf("返回结果不正确: %+v", resp)
+		}
+	}
+	if n := srv.uploadCount(); n != 1 {
+		t.Errorf("相同内容应只上传一次, 实际 %d 次", n)
+	}
+	if got := srv.forms[0]["overwrite"]; got != "true" {
+		t.Errorf("内容寻址上传应设置 overwrite=true, 实际 %q", got)
+	}
+
+	// 新客户端没有本地索引，通过 /view 查询到文件已存在
+	other := comfyui2go.NewClientWithOptions("upload-test-2", srv.URL,
+		comfyui2go.WithoutWebSocket(),
+		comfyui2go.WithUploadDedup(true),
+	)
+	if _, err := other.UploadImage(ctx, "another-name.png", bytes.NewReader(content)); err != nil {
+		t.Fatalf("上传失败: %v", err)
+	}
+	if n := srv.uploadCount(); n != 1 {
+		t.Errorf("服务器已存在的文件不应重复上传, 实际 %d 次", n)
+	}
+}
+
+// TestUploadOptions 测试上传选项与蒙版上传
+func TestUploadOptions(t *testing.T) {
+	srv := newFakeUploadServer(t)
+	ctx := context.Background()
+	client := comfyui2go.NewClientWithOptions("upload-test", srv.URL, comfyui2go.WithoutWebSocket())
+
+	t.Run("子文件夹、类型与覆盖", func(t *testing.T) {
+		resp, err := client.UploadImage(ctx, "a.png", strings.NewReader("a"),
+			comfyui2go.WithSubfolder("refs"),
+			comfyui2go.WithUploadType("temp"),
+			comfyui2go.WithOverwrite(true),
+		)
+		if err != nil {
+			t.Fatalf("上传失败: %v", err)
+		}
+		if resp.Subfolder != "refs" || resp.Type != "temp" {
+			t.Errorf("返回结果不正确: %+v", resp)
+		}
+		form := srv.forms[len(srv.forms)-1]
+		if form["subfolder"] != "refs" || form["type"] != "temp" || form["overwrite"] != "true" {
+			t.Errorf("表单字段不正确: %v", form)
+		}
+	})
+
+	t.Run("非法类型", func(t *testing.T) {
+		if _, err := client.UploadImage(ctx, "a.png", strings.NewReader("a"), comfyui2go.WithUploadType("models")); err == nil {
+			t.Error("非法上传类型应返回错误")
+		}
+	})
+
+	t.Run("蒙版上传", func(t *testing.T) {
+		original := comfyui2go.UploadResponse{Name: "photo.png", Subfolder: "refs", Type: "input"}
+		if _, err := client.UploadMask(ctx, "mask.png", strings.NewReader("m"), original); err != nil {
+			t.Fatalf("上传蒙版失败: %v", err)
+		}
+		form := srv.forms[len(srv.forms)-1]
+		want := `{"filename":"photo.png","subfolder":"refs","type":"input"}`
+		if form["original_ref"] != want {
+			t.Errorf("original_ref = %s, 期望 %s", form["original_ref"], want)
+		}
+	})
+}
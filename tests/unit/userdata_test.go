@@ -0,0 +1,186 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/deferz/comfyui2go"
+)
+
+// fakeUserDataServer 模拟按用户隔离的 /userdata 与 /settings
+type fakeUserDataServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	files    map[string]string // user/path -> 内容
+	settings map[string]map[string]interface{}
+}
+
+func newFakeUserDataServer(t *testing.T) *fakeUserDataServer {
+	t.Helper()
+	f := &fakeUserDataServer{files: map[string]string{}, settings: map[string]map[string]interface{}{}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.Server.Close)
+	return f
+}
+
+func (f *fakeUserDataServer) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user := r.Header.Get("comfy-user")
+	if user == "" {
+		user = "default"
+	}
+	path := r.URL.EscapedPath()
+	switch {
+	case path == "/userdata":
+		prefix := user + "/" + r.URL.Query().Get("dir") + "/"
+		var out []string
+		for k := range f.files {
+			if strings.HasPrefix(k, prefix) {
+				out = append(out, strings.TrimPrefix(k, prefix))
+			}
+		}
+		if out == nil {
+			http.NotFound(w, r)
+			return
+		}
+		writeJSON(w, out)
+	case strings.HasPrefix(path, "/userdata/"):
+		parts := strings.SplitN(strings.TrimPrefix(path, "/userdata/"), "/move/", 2)
+		file, _ := url.PathUnescape(parts[0])
+		key := user + "/" + file
+		overwrite := r.URL.Query().Get("overwrite") == "true"
+		switch {
+		case len(parts) == 2:
+			dest, _ := url.PathUnescape(parts[1])
+			if _, ok := f.files[user+"/"+dest]; ok && !overwrite {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			f.files[user+"/"+dest] = f.files[key]
+			delete(f.files, key)
+			writeJSON(w, dest)
+		case r.Method == http.MethodGet:
+			data, ok := f.files[key]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, data)
+		case r.Method == http.MethodPost:
+			if _, ok := f.files[key]; ok && !overwrite {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			data, _ := io.ReadAll(r.Body)
+			f.files[key] = string(data)
+			writeJSON(w, file)
+		case r.Method == http.MethodDelete:
+			delete(f.files, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case strings.HasPrefix(path, "/settings"):
+		if f.settings[user] == nil {
+			f.settings[user] = map[string]interface{}{}
+		}
+		id := strings.TrimPrefix(strings.TrimPrefix(path, "/settings"), "/")
+		switch {
+		case r.Method == http.MethodGet && id == "":
+			writeJSON(w, f.settings[user])
+		case r.Method == http.MethodGet:
+			writeJSON(w, f.settings[user][id])
+		case id == "":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			for k, v := range body {
+				f.settings[user][k] = v
+			}
+		default:
+			var v interface{}
+			json.NewDecoder(r.Body).Decode(&v)
+			f.settings[user][id] = v
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// TestUserData 测试 /userdata 的列出、读写、移动、删除与多用户隔离
+func TestUserData(t *testing.T) {
+	srv := newFakeUserDataServer(t)
+	ctx := context.Background()
+	alice := comfyui2go.NewClientWithOptions("userdata-test", srv.URL,
+		comfyui2go.WithoutWebSocket(), comfyui2go.WithComfyUser("alice"))
+	bob := comfyui2go.NewClientWithOptions("userdata-test", srv.URL,
+		comfyui2go.WithoutWebSocket(), comfyui2go.WithComfyUser("bob"))
+
+	if files, err := alice.ListUserData(ctx, "workflows", true); err != nil || len(files) != 0 {
+		t.Fatalf("不存在的目录应返回空列表: %v, %v", files, err)
+	}
+
+	if err := alice.SaveUserData(ctx, "workflows/team/portrait.json", []byte(`{"a":1}`), false); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	err := alice.SaveUserData(ctx, "workflows/team/portrait.json", []byte(`{}`), false)
+	if !errors.Is(err, comfyui2go.ErrUserDataExists) {
+		t.Errorf("重复保存应返回 ErrUserDataExists, 实际 %v", err)
+	}
+
+	files, err := alice.ListUserData(ctx, "workflows", true)
+	if err != nil || len(files) != 1 || files[0] != "team/portrait.json" {
+		t.Errorf("列出文件 = %v, %v", files, err)
+	}
+	if files, _ := bob.ListUserData(ctx, "workflows", true); len(files) != 0 {
+		t.Errorf("不同用户的文件应隔离: %v", files)
+	}
+
+	if err := alice.MoveUserData(ctx, "workflows/team/portrait.json", "workflows/portrait-v2.json", false); err != nil {
+		t.Fatalf("移动失败: %v", err)
+	}
+	data, err := alice.GetUserData(ctx, "workflows/portrait-v2.json")
+	if err != nil || string(data) != `{"a":1}` {
+		t.Errorf("读取文件 = %q, %v", data, err)
+	}
+
+	if err := alice.DeleteUserData(ctx, "workflows/portrait-v2.json"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if _, err := alice.GetUserData(ctx, "workflows/portrait-v2.json"); err == nil {
+		t.Error("删除后读取应返回错误")
+	}
+}
+
+// TestSettings 测试 /settings 的读取与写入
+func TestSettings(t *testing.T) {
+	srv := newFakeUserDataServer(t)
+	ctx := context.Background()
+	client := comfyui2go.NewClientWithOptions("settings-test", srv.URL, comfyui2go.WithoutWebSocket())
+
+	if err := client.SaveSettings(ctx, comfyui2go.JSON{"Comfy.LinkRenderMode": float64(2)}); err != nil {
+		t.Fatalf("保存设置失败: %v", err)
+	}
+	if err := client.SaveSetting(ctx, "Comfy.ColorPalette", "light"); err != nil {
+		t.Fatalf("保存单个设置失败: %v", err)
+	}
+
+	settings, err := client.GetSettings(ctx)
+	if err != nil {
+		t.Fatalf("读取设置失败: %v", err)
+	}
+	if settings["Comfy.LinkRenderMode"] != float64(2) || settings["Comfy.ColorPalette"] != "light" {
+		t.Errorf("设置 = %v", settings)
+	}
+	if v, err := client.GetSetting(ctx, "Comfy.ColorPalette"); err != nil || v != "light" {
+		t.Errorf("GetSetting = %v, %v", v, err)
+	}
+}
@@ -0,0 +1,243 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/deferz/comfyui2go"
+)
+
+// TestWaitForCompletionStatus 测试 WaitForCompletion 根据状态与消息判断成功或失败
+func TestWaitForCompletionStatus(t *testing.T) {
+	outputs := map[string]interface{}{
+		"9": map[string]interface{}{"images": []interface{}{map[string]interface{}{"filename": "a.png", "type": "output"}}},
+	}
+	items := map[string]interface{}{
+		"ok": map[string]interface{}{
+			"status":  map[string]interface{}{"status_str": "success", "completed": true, "messages": []interface{}{}},
+			"outputs": outputs,
+		},
+		// 出错但已有部分输出
+		"err": map[string]interface{}{
+			"prompt": []interface{}{1, "err", map[string]interface{}{"12": map[string]interface{}{"class_type": "VAEDecode"}}},
+			"status": map[string]interface{}{"status_str": "error", "completed": false, "messages": []interface{}{
+				[]interface{}{"execution_error", map[string]interface{}{
+					"prompt_id": "err", "node_id": "12", "exception_type": "RuntimeError",
+					"exception_message": "CUDA out of memory", "traceback": []interface{}{"a\n", "b\n"},
+				}},
+			}},
+			"outputs": outputs,
+		},
+		"interrupted": map[string]interface{}{
+			"status": map[string]interface{}{"status_str": "error", "completed": false, "messages": []interface{}{
+				[]interface{}{"execution_interrupted", map[string]interface{}{"prompt_id": "interrupted", "node_id": "3", "node_type": "KSampler"}},
+			}},
+			"outputs": map[string]interface{}{},
+		},
+		"bare-error": map[string]interface{}{
+			"status":  map[string]interface{}{"status_str": "error", "completed": false},
+			"outputs": map[string]interface{}{},
+		},
+		// 旧版本服务器没有 status
+		"legacy": map[string]interface{}{"outputs": outputs},
+	}
+
+	var mu sync.Mutex
+	polls := map[string]int{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/history/", func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/history/")
+		mu.Lock()
+		polls[id]++
+		n := polls[id]
+		mu.Unlock()
+		// 第一次查询时尚未写入历史记录
+		if n == 1 {
+			writeJSON(w, map[string]interface{}{})
+			return
+		}
+		writeJSON(w, map[string]interface{}{id: items[id]})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	client := comfyui2go.NewClientWithOptions("wait-test", srv.URL, comfyui2go.WithoutWebSocket())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	wait := func(id string) (*comfyui2go.WaitResult, *comfyui2go.ExecutionError, error) {
+		res, err := client.WaitForCompletion(ctx, id, 10*time.Millisecond)
+		var execErr *comfyui2go.ExecutionError
+		errors.As(err, &execErr)
+		return res, execErr, err
+	}
+
+	if res, _, err := wait("ok"); err != nil || len(res.Item.Assets()) != 1 {
+		t.Errorf("ok: %+v, %v", res, err)
+	}
+	if res, _, err := wait("legacy"); err != nil || res == nil {
+		t.Errorf("legacy: %+v, %v", res, err)
+	}
+
+	res, e, err := wait("err")
+	if e == nil {
+		t.Fatalf("err: 期望 ExecutionError, 得到 %v", err)
+	}
+	if e.NodeID != "12" || e.NodeType != "VAEDecode" || e.ExceptionType != "RuntimeError" || len(e.Traceback) != 2 || e.Interrupted {
+		t.Errorf("err: %+v", e)
+	}
+	if res == nil || len(res.Item.Assets()) != 1 {
+		t.Errorf("失败时应同时返回部分输出: %+v", res)
+	}
+	if err.Error() != "prompt err failed at node 12 (VAEDecode): RuntimeError: CUDA out of memory" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+
+	if _, e, err := wait("interrupted"); e == nil || !e.Interrupted || e.NodeID != "3" {
+		t.Errorf("interrupted: %+v, %v", e, err)
+	}
+	if _, e, err := wait("bare-error"); e == nil || e.NodeID != "" || err.Error() != "prompt bare-error failed" {
+		t.Errorf("bare-error: %+v, %v", e, err)
+	}
+}
+
+// TestWait 测试统一的等待入口
+func TestWait(t *testing.T) {
+	type outcome struct {
+		res *comfyui2go.WaitResult
+		err error
+	}
+	start := func(client *comfyui2go.Client, ctx context.Context, opts ...comfyui2go.WaitOption) <-chan outcome {
+		ch := make(chan outcome, 1)
+		go func() {
+			res, err := client.Wait(ctx, "p1", opts...)
+			ch <- outcome{res, err}
+		}()
+		return ch
+	}
+	// 轮询间隔远大于测试时长，只有事件驱动或回退轮询才能及时返回
+	slow := []comfyui2go.WaitOption{comfyui2go.WithPollInterval(10 * time.Second), comfyui2go.WithMaxPollInterval(20 * time.Second)}
+
+	t.Run("WebSocket事件", func(t *testing.T) {
+		srv := newFakeComfyServer(t)
+		srv.hang["p1"] = true
+		client := comfyui2go.NewClientWithOptions("wait-ws", srv.URL)
+		defer client.CloseWebSocket()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		done := start(client, ctx, slow...)
+		srv.waitForConn(t)
+		time.Sleep(50 * time.Millisecond)
+		srv.send(t, "execution_success", map[string]interface{}{"prompt_id": "p1"})
+		// 历史记录稍晚写入
+		time.Sleep(120 * time.Millisecond)
+		srv.complete("p1", nil)
+
+		o := <-done
+		if o.err != nil || o.res.PromptID != "p1" {
+			t.Fatalf("Wait = %+v, %v", o.res, o.err)
+		}
+	})
+
+	t.Run("调用前已结束", func(t *testing.T) {
+		srv := newFakeComfyServer(t)
+		srv.hang["p1"] = true
+		srv.complete("p1", nil)
+		client := comfyui2go.NewClientWithOptions("wait-done", srv.URL)
+		defer client.CloseWebSocket()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		if o := <-start(client, ctx, slow...); o.err != nil {
+			t.Fatalf("Wait 失败: %v", o.err)
+		}
+	})
+
+	t.Run("WebSocket断开后轮询", func(t *testing.T) {
+		srv := newFakeComfyServer(t)
+		srv.hang["p1"] = true
+		client := comfyui2go.NewClientWithOptions("wait-drop", srv.URL)
+		defer client.CloseWebSocket()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		done := start(client, ctx, comfyui2go.WithPollInterval(20*time.Millisecond), comfyui2go.WithMaxPollInterval(20*time.Second))
+		srv.waitForConn(t)
+		time.Sleep(50 * time.Millisecond)
+		srv.mu.Lock()
+		srv.rejectWS = true
+		conn := srv.conn
+		srv.mu.Unlock()
+		conn.Close(websocket.StatusGoingAway, "restart")
+		srv.complete("p1", nil)
+
+		if o := <-done; o.err != nil {
+			t.Fatalf("Wait 失败: %v", o.err)
+		}
+	})
+
+	t.Run("失败事件", func(t *testing.T) {
+		srv := newFakeComfyServer(t)
+		srv.hang["p1"] = true
+		failed := map[string]interface{}{
+			"status": map[string]interface{}{"status_str": "error", "completed": false, "messages": []interface{}{
+				[]interface{}{"execution_error", map[string]interface{}{"prompt_id": "p1", "node_id": "5", "node_type": "KSampler", "exception_message": "boom"}},
+			}},
+		}
+		client := comfyui2go.NewClientWithOptions("wait-err", srv.URL)
+		defer client.CloseWebSocket()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		done := start(client, ctx, slow...)
+		srv.waitForConn(t)
+		time.Sleep(50 * time.Millisecond)
+		srv.complete("p1", failed)
+		srv.send(t, "execution_error", map[string]interface{}{"prompt_id": "p1", "node_id": "5", "node_type": "KSampler", "exception_message": "boom"})
+
+		o := <-done
+		var execErr *comfyui2go.ExecutionError
+		if !errors.As(o.err, &execErr) || execErr.NodeID != "5" || o.res == nil {
+			t.Fatalf("Wait = %+v, %v", o.res, o.err)
+		}
+	})
+
+	t.Run("禁用WebSocket时自适应轮询", func(t *testing.T) {
+		srv := newFakeComfyServer(t)
+		srv.hang["p1"] = true
+		client := comfyui2go.NewClientWithOptions("wait-poll", srv.URL, comfyui2go.WithoutWebSocket())
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		done := start(client, ctx, comfyui2go.WithPollInterval(10*time.Millisecond), comfyui2go.WithMaxPollInterval(40*time.Millisecond))
+		time.Sleep(300 * time.Millisecond)
+		srv.complete("p1", nil)
+		if o := <-done; o.err != nil {
+			t.Fatalf("Wait 失败: %v", o.err)
+		}
+		srv.mu.Lock()
+		polls := srv.lookups
+		srv.mu.Unlock()
+		// 间隔从 10ms 放慢到 40ms：300ms 内固定 10ms 间隔约需 30 次
+		if polls < 5 || polls > 20 {
+			t.Errorf("轮询次数 = %d", polls)
+		}
+	})
+
+	t.Run("超时返回最后的错误", func(t *testing.T) {
+		client := comfyui2go.NewClientWithOptions("wait-timeout", "http://127.0.0.1:1", comfyui2go.WithoutWebSocket())
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		_, err := client.Wait(ctx, "p1", comfyui2go.WithPollInterval(20*time.Millisecond))
+		if !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "127.0.0.1:1") {
+			t.Errorf("Wait = %v", err)
+		}
+	})
+}
@@ -0,0 +1,360 @@
+package comfyui2go
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HistoryMessage 为 HistoryStatus.Messages 中的一条执行事件，原始格式为 [event_name, {prompt_id, timestamp, ...}]。
+// 历史记录只保存 execution_start、execution_cached、execution_success、execution_error、
+// execution_interrupted 等任务级事件，不包含逐个节点的 executing 事件。
+type HistoryMessage struct {
+	Event string
+	Data  JSON
+}
+
+// UnmarshalJSON 解析 [event_name, data] 形式的消息；格式不符时保留空消息而不报错，避免整条历史解析失败
+func (m *HistoryMessage) UnmarshalJSON(b []byte) error {
+	var pair []json.RawMessage
+	if err := json.Unmarshal(b, &pair); err != nil || len(pair) == 0 {
+		return nil
+	}
+	_ = json.Unmarshal(pair[0], &m.Event)
+	if len(pair) > 1 {
+		_ = json.Unmarshal(pair[1], &m.Data)
+	}
+	return nil
+}
+
+// MarshalJSON 编码为服务器的 [event_name, data] 形式
+func (m HistoryMessage) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{m.Event, m.Data})
+}
+
+// Timestamp 返回服务器记录的事件时间（data.timestamp，毫秒），不存在时返回零值
+func (m HistoryMessage) Timestamp() time.Time {
+	return timestampOf(m.Data)
+}
+
+func timestampOf(data JSON) time.Time {
+	if ms, ok := data["timestamp"].(float64); ok && ms > 0 {
+		return time.UnixMilli(int64(ms))
+	}
+	return time.Time{}
+}
+
+// ExecutionError 描述执行失败的位置与原因，对应 execution_error / execution_interrupted 事件。
+type ExecutionError struct {
+	PromptID         string
+	NodeID           string
+	NodeType         string
+	ExceptionType    string
+	ExceptionMessage string
+	Traceback        []string
+	// Executed 为失败前已执行完的节点
+	Executed []string
+	// Interrupted 为 true 表示任务被中断而非出错
+	Interrupted bool
+}
+
+func (e *ExecutionError) Error() string {
+	if e.NodeID == "" && !e.Interrupted {
+		return fmt.Sprintf("prompt %s failed", e.PromptID)
+	}
+	if e.Interrupted {
+		if e.NodeID != "" {
+			return fmt.Sprintf("prompt %s interrupted at node %s (%s)", e.PromptID, e.NodeID, e.NodeType)
+		}
+		return fmt.Sprintf("prompt %s interrupted", e.PromptID)
+	}
+	msg := e.ExceptionMessage
+	if e.ExceptionType != "" {
+		msg = e.ExceptionType + ": " + msg
+	}
+	return fmt.Sprintf("prompt %s failed at node %s (%s): %s", e.PromptID, e.NodeID, e.NodeType, strings.TrimSpace(msg))
+}
+
+// executionErrorFrom 从 execution_error / execution_interrupted 事件数据构建 ExecutionError
+func executionErrorFrom(event string, data JSON) *ExecutionError {
+	e := &ExecutionError{Interrupted: event == "execution_interrupted"}
+	e.PromptID, _ = data["prompt_id"].(string)
+	e.NodeID, _ = data["node_id"].(string)
+	e.NodeType, _ = data["node_type"].(string)
+	e.ExceptionType, _ = data["exception_type"].(string)
+	e.ExceptionMessage, _ = data["exception_message"].(string)
+	e.Traceback = stringList(data["traceback"])
+	e.Executed = stringList(data["executed"])
+	return e
+}
+
+func stringList(v interface{}) []string {
+	items, _ := v.([]interface{})
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		if s, ok := it.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Finished 报告历史记录是否表示任务已结束（成功或失败）。
+// 旧版本服务器的历史记录没有 status，此时以存在 outputs 为准。
+func (h HistoryItem) Finished() bool {
+	if h.Status == nil {
+		return h.Outputs != nil
+	}
+	return h.Status.Completed || h.Status.StatusStr == "success" || h.Status.StatusStr == "error"
+}
+
+// Failure 返回任务失败的原因，任务成功或尚未结束时返回 nil。
+// 优先使用 execution_error / execution_interrupted 消息中的节点、异常与 traceback；
+// 只有 status_str 为 "error" 时返回不含节点信息的 ExecutionError。
+func (h HistoryItem) Failure() *ExecutionError {
+	if h.Status == nil {
+		return nil
+	}
+	for _, m := range h.Status.Messages {
+		if m.Event == "execution_error" || m.Event == "execution_interrupted" {
+			e := executionErrorFrom(m.Event, m.Data)
+			if e.PromptID == "" {
+				e.PromptID = h.promptID()
+			}
+			if e.NodeType == "" {
+				if node, ok := h.Workflow()[e.NodeID].(map[string]interface{}); ok {
+					e.NodeType, _ = node["class_type"].(string)
+				}
+			}
+			return e
+		}
+	}
+	if h.Status.StatusStr == "error" {
+		return &ExecutionError{PromptID: h.promptID()}
+	}
+	return nil
+}
+
+// historyFailure 返回失败原因，历史记录中没有 prompt_id 时使用调用方已知的 promptID
+func historyFailure(promptID string, item HistoryItem) *ExecutionError {
+	failure := item.Failure()
+	if failure != nil && failure.PromptID == "" {
+		failure.PromptID = promptID
+	}
+	return failure
+}
+
+// promptID 返回历史记录中保存的 prompt_id（prompt 字段的第二项）
+func (h HistoryItem) promptID() string {
+	if len(h.Prompt) < 2 {
+		return ""
+	}
+	id, _ := h.Prompt[1].(string)
+	return id
+}
+
+// NodeTiming 为单个节点的执行时间段
+type NodeTiming struct {
+	NodeID    string
+	ClassType string
+	Start     time.Time
+	End       time.Time
+}
+
+// Duration 返回节点耗时，节点尚未结束时为 0
+func (n NodeTiming) Duration() time.Duration {
+	if n.End.IsZero() {
+		return 0
+	}
+	return n.End.Sub(n.Start)
+}
+
+// ExecutionTimeline 为一个 prompt 的执行时间线。
+// 从历史记录构建时只有任务级时间、缓存节点与错误位置；逐节点耗时需通过 WatchTimeline 从 WebSocket 事件获得。
+type ExecutionTimeline struct {
+	PromptID string
+	// Status 为 "success"、"error"、"interrupted"，尚未结束时为空
+	Status string
+	Start  time.Time
+	End    time.Time
+	// Nodes 按执行顺序排列
+	Nodes []NodeTiming
+	// Cached 为命中缓存而未执行的节点
+	Cached []string
+	// Error 为失败位置，仅 Status 为 "error" 或 "interrupted" 时存在
+	Error *ExecutionError
+}
+
+// Duration 返回总耗时，尚未结束时为 0
+func (t *ExecutionTimeline) Duration() time.Duration {
+	if t.Start.IsZero() || t.End.IsZero() {
+		return 0
+	}
+	return t.End.Sub(t.Start)
+}
+
+// Slowest 返回耗时最长的已结束节点
+func (t *ExecutionTimeline) Slowest() (NodeTiming, bool) {
+	var best NodeTiming
+	found := false
+	for _, n := range t.Nodes {
+		if n.End.IsZero() {
+			continue
+		}
+		if !found || n.Duration() > best.Duration() {
+			best, found = n, true
+		}
+	}
+	return best, found
+}
+
+// Workflow 返回历史记录中保存的工作流（prompt 字段的第三项），不存在时返回 nil
+func (h HistoryItem) Workflow() JSON {
+	if len(h.Prompt) < 3 {
+		return nil
+	}
+	wf, _ := h.Prompt[2].(map[string]interface{})
+	return wf
+}
+
+// TimelineFromHistory 从历史记录的 status.messages 构建时间线
+func TimelineFromHistory(promptID string, item HistoryItem) *ExecutionTimeline {
+	b := NewTimelineBuilder(promptID, item.Workflow())
+	if item.Status != nil {
+		for _, m := range item.Status.Messages {
+			b.ObserveAt(WSMessage{Type: m.Event, Data: m.Data}, m.Timestamp())
+		}
+		if b.t.Status == "" && item.Status.StatusStr == "error" {
+			b.t.Status, b.t.Error = "error", historyFailure(promptID, item)
+		}
+	}
+	return b.Timeline()
+}
+
+// GetTimeline 获取历史记录并构建时间线
+func (c *Client) GetTimeline(ctx context.Context, promptID string) (*ExecutionTimeline, error) {
+	h, err := c.GetHistory(ctx, promptID)
+	if err != nil {
+		return nil, err
+	}
+	item, ok := h[promptID]
+	if !ok {
+		return nil, fmt.Errorf("prompt %s not found in history", promptID)
+	}
+	return TimelineFromHistory(promptID, item), nil
+}
+
+// TimelineBuilder 根据执行事件逐步构建时间线，并发安全
+type TimelineBuilder struct {
+	mu         sync.Mutex
+	t          ExecutionTimeline
+	classTypes map[string]string
+	done       chan struct{}
+}
+
+// NewTimelineBuilder 创建时间线构建器，workflow 用于填充节点的 class_type，可为 nil
+func NewTimelineBuilder(promptID string, workflow JSON) *TimelineBuilder {
+	classTypes := make(map[string]string, len(workflow))
+	for id, v := range workflow {
+		if node, ok := v.(map[string]interface{}); ok {
+			if ct, ok := node["class_type"].(string); ok {
+				classTypes[id] = ct
+			}
+		}
+	}
+	return &TimelineBuilder{t: ExecutionTimeline{PromptID: promptID}, classTypes: classTypes, done: make(chan struct{})}
+}
+
+// Observe 以当前时间记录一条事件
+func (b *TimelineBuilder) Observe(msg WSMessage) {
+	b.ObserveAt(msg, time.Now())
+}
+
+// ObserveAt 以指定时间记录一条事件，其他 prompt 的事件会被忽略
+func (b *TimelineBuilder) ObserveAt(msg WSMessage, at time.Time) {
+	if id, _ := msg.Data["prompt_id"].(string); id != b.t.PromptID {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.t.Status != "" {
+		return
+	}
+	closeNode := func() {
+		if n := len(b.t.Nodes); n > 0 && b.t.Nodes[n-1].End.IsZero() {
+			b.t.Nodes[n-1].End = at
+		}
+	}
+	finish := func(status string) {
+		closeNode()
+		b.t.Status, b.t.End = status, at
+		close(b.done)
+	}
+
+	switch msg.Type {
+	case "execution_start":
+		b.t.Start = at
+	case "execution_cached":
+		b.t.Cached = append(b.t.Cached, stringList(msg.Data["nodes"])...)
+	case "executing":
+		closeNode()
+		node, _ := msg.Data["node"].(string)
+		if node == "" {
+			// 旧版本服务器没有 execution_success，以 node 为空表示执行完成
+			finish("success")
+			return
+		}
+		if b.t.Start.IsZero() {
+			b.t.Start = at
+		}
+		b.t.Nodes = append(b.t.Nodes, NodeTiming{NodeID: node, ClassType: b.classTypes[node], Start: at})
+	case "execution_success":
+		finish("success")
+	case "execution_error", "execution_interrupted":
+		b.t.Error = executionErrorFrom(msg.Type, msg.Data)
+		if b.t.Error.NodeType == "" {
+			b.t.Error.NodeType = b.classTypes[b.t.Error.NodeID]
+		}
+		if msg.Type == "execution_error" {
+			finish("error")
+		} else {
+			finish("interrupted")
+		}
+	}
+}
+
+// Timeline 返回当前时间线的副本
+func (b *TimelineBuilder) Timeline() *ExecutionTimeline {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.t
+	t.Nodes = append([]NodeTiming(nil), b.t.Nodes...)
+	t.Cached = append([]string(nil), b.t.Cached...)
+	return &t
+}
+
+// Done 在任务结束（成功、失败或中断）时关闭
+func (b *TimelineBuilder) Done() <-chan struct{} {
+	return b.done
+}
+
+// WatchTimeline 通过 WebSocket 事件实时构建 prompt 的时间线（逐节点耗时以本地接收时间计），任务结束后自动停止。
+// 应在 Prompt 返回后立即调用；调用前已发生的事件不会被记录。ctx 结束时停止记录。
+func (c *Client) WatchTimeline(ctx context.Context, promptID string, workflow JSON) (*TimelineBuilder, error) {
+	if err := c.ensureWebSocketConnected(ctx); err != nil {
+		return nil, err
+	}
+	b := NewTimelineBuilder(promptID, workflow)
+	remove := c.addWSListener(b.Observe)
+	go func() {
+		select {
+		case <-b.Done():
+		case <-ctx.Done():
+		}
+		remove()
+	}()
+	return b, nil
+}
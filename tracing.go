@@ -0,0 +1,135 @@
+package comfyui2go
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+
+	resty "resty.dev/v3"
+)
+
+// Tracer 创建追踪 span，用于接入 OpenTelemetry 等追踪系统（本库不依赖它们）。实现需并发安全。
+//
+// 客户端会为以下操作创建 span：
+//   - 每个 HTTP 请求与 WebSocket 握手（"comfyui.http"、"comfyui.websocket.connect"）
+//   - 每个 prompt 的生命周期（"comfyui.prompt"）：提交后记录 "queued" 事件，开始执行记录 "execution_start"，
+//     每个节点一个子 span（"comfyui.node"），执行结束时结束；执行阶段的事件来自 WebSocket
+type Tracer interface {
+	// Start 以 ctx 中的 span 为父 span 创建新的 span，返回携带新 span 的 ctx
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span 为一次被追踪的操作
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	AddEvent(name string, attrs ...Attribute)
+	// End 结束 span，err 非空表示操作失败
+	End(err error)
+	// TraceParent 返回 W3C traceparent 头的值（可用 FormatTraceParent 生成），为空时不注入
+	TraceParent() string
+}
+
+// Attribute 为 span 或事件的属性
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr 创建属性
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// FormatTraceParent 生成 W3C traceparent 头的值（版本 00）
+func FormatTraceParent(traceID [16]byte, spanID [8]byte, sampled bool) string {
+	flags := "00"
+	if sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(traceID[:]) + "-" + hex.EncodeToString(spanID[:]) + "-" + flags
+}
+
+// WithTracer 设置追踪。HTTP 请求会携带 traceparent 头，span 的父子关系来自调用方传入的 ctx。
+func WithTracer(t Tracer) Option {
+	return func(c *Client) { c.tracer = t }
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, _ string, _ ...Attribute) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute)    {}
+func (noopSpan) AddEvent(string, ...Attribute) {}
+func (noopSpan) End(error)                     {}
+func (noopSpan) TraceParent() string           { return "" }
+
+// tracing 返回客户端追踪，未设置时返回空实现
+func (c *Client) tracing() Tracer {
+	if c.tracer == nil {
+		return noopTracer{}
+	}
+	return c.tracer
+}
+
+// injectTraceParent 将 span 的 traceparent 写入请求头
+func injectTraceParent(span Span, h http.Header) {
+	if tp := span.TraceParent(); tp != "" {
+		h.Set("traceparent", tp)
+	}
+}
+
+// httpSpan 保证重试时复用同一个 span 且只结束一次
+type httpSpan struct {
+	span Span
+	once sync.Once
+}
+
+func (s *httpSpan) end(err error) {
+	s.once.Do(func() { s.span.End(err) })
+}
+
+type httpSpanKey struct{}
+
+// installTracing 在 HTTP 请求链上为每个请求创建 span。
+// 请求中间件每次尝试都会执行，span 存放在请求的 ctx 中以便重试时复用；请求结束（含重试）后结束 span。
+func (c *Client) installTracing() {
+	tracer := c.tracer
+	c.cli.AddRequestMiddleware(func(_ *resty.Client, r *resty.Request) error {
+		s, ok := r.Context().Value(httpSpanKey{}).(*httpSpan)
+		if !ok {
+			ctx, span := tracer.Start(r.Context(), "comfyui.http",
+				Attr("http.request.method", r.Method),
+				Attr("url.path", requestPath(r)),
+			)
+			s = &httpSpan{span: span}
+			r.SetContext(context.WithValue(ctx, httpSpanKey{}, s))
+		}
+		injectTraceParent(s.span, r.Header)
+		return nil
+	})
+	c.cli.OnSuccess(func(_ *resty.Client, r *resty.Response) {
+		s, ok := r.Request.Context().Value(httpSpanKey{}).(*httpSpan)
+		if !ok {
+			return
+		}
+		s.span.SetAttributes(Attr("http.response.status_code", r.StatusCode()))
+		var err error
+		if r.StatusCode() >= 400 {
+			err = fmt.Errorf("%s %s failed: %s", r.Request.Method, requestPath(r.Request), r.Status())
+		}
+		s.end(err)
+	})
+	endOnError := func(r *resty.Request, err error) {
+		if s, ok := r.Context().Value(httpSpanKey{}).(*httpSpan); ok {
+			s.end(err)
+		}
+	}
+	c.cli.OnError(endOnError)
+	c.cli.OnInvalid(endOnError)
+}
@@ -0,0 +1,107 @@
+package comfyui2go
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// transportOptions 为 HTTP 与 WebSocket 共用的传输层配置，在所有选项应用完后统一生效，
+// 因此与 WithHTTP 的先后顺序无关。
+type transportOptions struct {
+	tlsConfig *tls.Config
+	rootCAs   *x509.CertPool
+	certs     []tls.Certificate
+	insecure  bool
+	proxy     func(*http.Request) (*url.URL, error)
+}
+
+func (t *transportOptions) isZero() bool {
+	return t.tlsConfig == nil && t.rootCAs == nil && len(t.certs) == 0 && !t.insecure && t.proxy == nil
+}
+
+// WithTLSConfig 设置基础 TLS 配置，WithRootCAs 等选项在其副本上叠加。
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) { c.transport.tlsConfig = cfg }
+}
+
+// WithRootCAs 设置用于校验服务器证书的 CA（如企业内部 CA）。
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c *Client) { c.transport.rootCAs = pool }
+}
+
+// WithClientCertificates 设置客户端证书，用于双向 TLS（mTLS）。
+func WithClientCertificates(certs ...tls.Certificate) Option {
+	return func(c *Client) { c.transport.certs = append(c.transport.certs, certs...) }
+}
+
+// WithInsecureSkipVerify 跳过服务器证书校验，仅用于实验环境。
+func WithInsecureSkipVerify() Option {
+	return func(c *Client) { c.transport.insecure = true }
+}
+
+// WithProxy 设置代理，支持 http://、https:// 和 socks5:// 地址；为空时不使用代理（忽略环境变量）。
+// 地址无效时在发起请求时返回错误。
+func WithProxy(proxyURL string) Option {
+	return func(c *Client) {
+		if proxyURL == "" {
+			c.transport.proxy = func(*http.Request) (*url.URL, error) { return nil, nil }
+			return
+		}
+		u, err := url.Parse(proxyURL)
+		if err == nil && u.Host == "" {
+			err = fmt.Errorf("missing host")
+		}
+		if err != nil {
+			err = fmt.Errorf("invalid proxy %q: %w", proxyURL, err)
+			c.transport.proxy = func(*http.Request) (*url.URL, error) { return nil, err }
+			return
+		}
+		c.transport.proxy = http.ProxyURL(u)
+	}
+}
+
+// applyTransport 将传输层配置应用到 resty 客户端的 http.Transport。
+// WebSocket 握手使用同一个 http.Client（见 httpClient），因此两条通道的 TLS 与代理保持一致。
+// 通过 WithHTTP 传入的自定义 RoundTripper 不是 *http.Transport 时保持不变。
+func (c *Client) applyTransport() {
+	if c.transport.isZero() {
+		return
+	}
+	base, err := c.cli.HTTPTransport()
+	if err != nil {
+		return
+	}
+	t := base.Clone()
+
+	var cfg *tls.Config
+	switch {
+	case c.transport.tlsConfig != nil:
+		cfg = c.transport.tlsConfig.Clone()
+	case t.TLSClientConfig != nil:
+		cfg = t.TLSClientConfig.Clone()
+	default:
+		cfg = &tls.Config{}
+	}
+	if c.transport.rootCAs != nil {
+		cfg.RootCAs = c.transport.rootCAs
+	}
+	if len(c.transport.certs) > 0 {
+		cfg.Certificates = append(cfg.Certificates, c.transport.certs...)
+	}
+	if c.transport.insecure {
+		cfg.InsecureSkipVerify = true
+	}
+	t.TLSClientConfig = cfg
+	if c.transport.proxy != nil {
+		t.Proxy = c.transport.proxy
+	}
+	c.cli.SetTransport(t)
+}
+
+// httpClient 返回 resty 底层的 http.Client，供 WebSocket 握手复用其传输层
+func (c *Client) httpClient() *http.Client {
+	return c.cli.Client()
+}
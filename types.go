@@ -1,6 +1,9 @@
 package comfyui2go
 
-import "time"
+import (
+	"sort"
+	"time"
+)
 
 // 通用 JSON 类型别名，保持灵活性。
 // 许多字段使用 map[string]interface{}，因为 ComfyUI 的节点/工作流结构可能随版本和节点实现而变化。
@@ -50,6 +53,8 @@ type HistoryResponse map[string]HistoryItem
 type HistoryItem struct {
 	Status  *HistoryStatus `json:"status,omitempty"`
 	Outputs JSON           `json:"outputs,omitempty"`
+	// Prompt 为 [number, prompt_id, workflow, extra_data, outputs_to_execute]
+	Prompt []interface{} `json:"prompt,omitempty"`
 	// Raw 保留剩余字段，避免信息丢失。
 	Raw JSON `json:"-"`
 }
@@ -57,13 +62,17 @@ type HistoryItem struct {
 type HistoryStatus struct {
 	StatusStr string `json:"status_str,omitempty"`
 	Completed bool   `json:"completed"`
-	// Messages 是复杂结构的数组，包含执行事件信息
-	Messages []interface{} `json:"messages,omitempty"`
+	// Messages 为执行事件，可用 TimelineFromHistory 构建时间线
+	Messages []HistoryMessage `json:"messages,omitempty"`
 	// 其他时间字段（实际可能不存在）
 	Started  *time.Time `json:"started_at,omitempty"`
 	Finished *time.Time `json:"finished_at,omitempty"`
 }
 
+// ObjectInfo 对应 GET /object_info，键为节点 class_type。
+// 节点定义结构随节点实现变化，因此保持松散的 JSON。
+type ObjectInfo map[string]JSON
+
 // UploadResponse 用于上传相关响应的占位（若后续扩展上传 API）。
 type UploadResponse struct {
 	Name      string `json:"name,omitempty"`
@@ -73,6 +82,20 @@ type UploadResponse struct {
 	Unknown JSON `json:"-"`
 }
 
+// OutputAsset 描述历史记录输出中的一个文件，可直接用于 Download。
+type OutputAsset struct {
+	NodeID    string `json:"node_id"`
+	Kind      string `json:"kind"` // 输出字段名，如 "images"、"gifs"、"audio"
+	Filename  string `json:"filename"`
+	Subfolder string `json:"subfolder"`
+	Type      string `json:"type"` // "output"、"temp" 或 "input"
+}
+
+// Assets 从 Outputs 中提取全部输出文件，按节点ID和输出字段名排序。
+func (h HistoryItem) Assets() []OutputAsset {
+	return outputAssets(h.Outputs)
+}
+
 // WaitResult 为 WaitForCompletion 的便捷结果类型。
 // 当任务完成时包含对应的 HistoryItem。
 type WaitResult struct {
@@ -80,6 +103,47 @@ type WaitResult struct {
 	Item     HistoryItem `json:"item"`
 }
 
+// SystemStats 对应 GET /system_stats。
+type SystemStats struct {
+	System  SystemInfo `json:"system"`
+	Devices []Device   `json:"devices"`
+}
+
+// SystemInfo 为服务器的系统与版本信息，内存单位为字节。
+type SystemInfo struct {
+	OS             string   `json:"os"`
+	PythonVersion  string   `json:"python_version"`
+	ComfyUIVersion string   `json:"comfyui_version,omitempty"`
+	PytorchVersion string   `json:"pytorch_version,omitempty"`
+	EmbeddedPython bool     `json:"embedded_python"`
+	RAMTotal       int64    `json:"ram_total"`
+	RAMFree        int64    `json:"ram_free"`
+	Argv           []string `json:"argv,omitempty"`
+}
+
+// Device 为计算设备信息，显存单位为字节。
+// VRAM* 为设备整体显存，TorchVRAM* 为 PyTorch 缓存分配器保留的部分。
+type Device struct {
+	Name           string `json:"name"`
+	Type           string `json:"type"` // 如 "cuda"、"mps"、"cpu"
+	Index          *int   `json:"index"`
+	VRAMTotal      int64  `json:"vram_total"`
+	VRAMFree       int64  `json:"vram_free"`
+	TorchVRAMTotal int64  `json:"torch_vram_total"`
+	TorchVRAMFree  int64  `json:"torch_vram_free"`
+}
+
+// MaxVRAMFree 返回所有设备中最大的空闲显存（字节），没有设备时返回 0。
+func (s *SystemStats) MaxVRAMFree() int64 {
+	var best int64
+	for _, d := range s.Devices {
+		if d.VRAMFree > best {
+			best = d.VRAMFree
+		}
+	}
+	return best
+}
+
 // WebSocket 消息类型定义
 
 // WSMessage 表示通过WebSocket接收的消息
@@ -116,6 +180,9 @@ type WSExecutingMessage struct {
 type WSProgressMessage struct {
 	Value int `json:"value"`
 	Max   int `json:"max"`
+	// PromptID 与 Node 为所属任务和节点，旧版本服务器的进度消息不携带
+	PromptID string `json:"prompt_id,omitempty"`
+	Node     string `json:"node,omitempty"`
 }
 
 // WSExecutionErrorMessage 执行错误消息
@@ -137,3 +204,59 @@ type ExecutionCallback func(promptID string, nodeID *string)
 
 // ErrorCallback 错误回调函数类型
 type ErrorCallback func(promptID string, err error)
+
+// outputAssets 解析形如 node_id -> {kind: [{filename, subfolder, type}]} 的输出结构
+func outputAssets(outputs JSON) []OutputAsset {
+	nodeIDs := make([]string, 0, len(outputs))
+	for id := range outputs {
+		nodeIDs = append(nodeIDs, id)
+	}
+	sort.Strings(nodeIDs)
+
+	var assets []OutputAsset
+	for _, id := range nodeIDs {
+		assets = append(assets, nodeOutputAssets(id, outputs[id])...)
+	}
+	return assets
+}
+
+// nodeOutputAssets 解析单个节点的输出
+func nodeOutputAssets(nodeID string, output interface{}) []OutputAsset {
+	fields, ok := output.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	kinds := make([]string, 0, len(fields))
+	for k := range fields {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+
+	var assets []OutputAsset
+	for _, kind := range kinds {
+		list, ok := fields[kind].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, v := range list {
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			filename, _ := m["filename"].(string)
+			if filename == "" {
+				continue
+			}
+			subfolder, _ := m["subfolder"].(string)
+			typ, _ := m["type"].(string)
+			assets = append(assets, OutputAsset{
+				NodeID:    nodeID,
+				Kind:      kind,
+				Filename:  filename,
+				Subfolder: subfolder,
+				Type:      typ,
+			})
+		}
+	}
+	return assets
+}
@@ -0,0 +1,170 @@
+package comfyui2go
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// UploadOption 用于自定义单次上传
+type UploadOption func(*uploadOptions)
+
+type uploadOptions struct {
+	subfolder  string
+	typ        string
+	overwrite  bool
+	preprocess *PreprocessOptions
+}
+
+// WithSubfolder 设置上传到目标目录下的子文件夹
+func WithSubfolder(subfolder string) UploadOption {
+	return func(o *uploadOptions) { o.subfolder = subfolder }
+}
+
+// WithUploadType 设置上传目标目录："input"（默认）、"temp" 或 "output"
+func WithUploadType(typ string) UploadOption {
+	return func(o *uploadOptions) { o.typ = typ }
+}
+
+// WithOverwrite 设置是否覆盖同名文件。
+// 不覆盖时，服务器对同名同内容的文件直接复用，同名不同内容的文件会被重命名为 "name (1).png"。
+func WithOverwrite(overwrite bool) UploadOption {
+	return func(o *uploadOptions) { o.overwrite = overwrite }
+}
+
+func newUploadOptions(opts []UploadOption) (*uploadOptions, error) {
+	o := &uploadOptions{typ: "input"}
+	for _, opt := range opts {
+		opt(o)
+	}
+	switch o.typ {
+	case "input", "temp", "output":
+	default:
+		return nil, fmt.Errorf("invalid upload type %q", o.typ)
+	}
+	if o.preprocess != nil && o.preprocess.ExtractMask {
+		// 上传只返回一个文件引用，提取的蒙版无处可放
+		return nil, fmt.Errorf("WithPreprocess does not support ExtractMask: call PreprocessImage, then upload Data and Mask (UploadMask with the image reference)")
+	}
+	return o, nil
+}
+
+// prepare 按需执行预处理，返回实际上传的文件名和内容
+func (o *uploadOptions) prepare(filename string, data io.Reader) (string, io.Reader, error) {
+	if o.preprocess == nil {
+		return filename, data, nil
+	}
+	img, err := PreprocessImage(data, filename, *o.preprocess)
+	if err != nil {
+		return "", nil, err
+	}
+	return img.Filename, bytes.NewReader(img.Data), nil
+}
+
+// form 生成上传表单字段
+func (o *uploadOptions) form() map[string]string {
+	form := map[string]string{"type": o.typ}
+	if o.subfolder != "" {
+		form["subfolder"] = o.subfolder
+	}
+	if o.overwrite {
+		form["overwrite"] = "true"
+	}
+	return form
+}
+
+// WithUploadDedup 启用内容寻址上传：UploadImage 会按内容的 SHA-256 命名文件，
+// 若服务器目标目录中已存在同名文件（本地索引或 /view 查询）则跳过上传，直接返回相同的 UploadResponse。
+func WithUploadDedup(enable bool) Option {
+	return func(c *Client) { c.uploadDedup = enable }
+}
+
+// ContentAddressedName 返回内容寻址的文件名：内容 SHA-256 十六进制 + 原文件扩展名（小写）。
+func ContentAddressedName(filename string, data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + strings.ToLower(filepath.Ext(filename))
+}
+
+// uploadImageDedup 以内容寻址方式上传图片
+func (c *Client) uploadImageDedup(ctx context.Context, filename string, data io.Reader, o *uploadOptions) (*UploadResponse, error) {
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	name := ContentAddressedName(filename, content)
+	key := o.typ + "/" + o.subfolder + "/" + name
+
+	c.uploadMu.Lock()
+	cached, ok := c.uploadIndex[key]
+	c.uploadMu.Unlock()
+	if ok {
+		resp := cached
+		return &resp, nil
+	}
+
+	exists, err := c.fileExists(ctx, name, o.subfolder, o.typ)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *UploadResponse
+	if exists {
+		resp = &UploadResponse{Name: name, Subfolder: o.subfolder, Type: o.typ}
+	} else {
+		// 同名即同内容，因此可以安全地覆盖，避免服务器端重命名为 "name (1).png"
+		form := o.form()
+		form["overwrite"] = "true"
+		resp, err = c.upload(ctx, "/upload/image", name, bytes.NewReader(content), form)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.uploadMu.Lock()
+	if c.uploadIndex == nil {
+		c.uploadIndex = make(map[string]UploadResponse)
+	}
+	c.uploadIndex[key] = *resp
+	c.uploadMu.Unlock()
+	return resp, nil
+}
+
+// fileExists 通过 HEAD /view 判断服务器目录中是否已存在文件（不支持 HEAD 时退化为 GET）
+func (c *Client) fileExists(ctx context.Context, filename, subfolder, filetype string) (bool, error) {
+	params := map[string]string{
+		"filename":  filename,
+		"subfolder": subfolder,
+		"type":      filetype,
+	}
+	r, err := c.cli.R().SetContext(ctx).SetQueryParams(params).Head("/view")
+	if err != nil {
+		return false, err
+	}
+	if r.StatusCode() == http.StatusMethodNotAllowed {
+		r, err = c.cli.R().SetContext(ctx).SetQueryParams(params).Get("/view")
+		if err != nil {
+			return false, err
+		}
+	}
+	switch {
+	case r.IsSuccess():
+		return true, nil
+	case r.StatusCode() == http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("HEAD /view failed: %s", r.Status())
+	}
+}
+
+// ForgetUploads 清空内容寻址上传的本地索引（如服务器输入目录被清理后）
+func (c *Client) ForgetUploads() {
+	c.uploadMu.Lock()
+	c.uploadIndex = nil
+	c.uploadMu.Unlock()
+}
@@ -0,0 +1,216 @@
+package comfyui2go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ErrUserDataExists 表示目标文件已存在且未指定覆盖（服务器返回 409）。
+var ErrUserDataExists = errors.New("userdata file already exists")
+
+// UserDataFile 为 /userdata 列表中的文件信息（full_info=true 时返回）。
+type UserDataFile struct {
+	// Path 为相对于列出目录的路径，使用 "/" 分隔
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Modified 为修改时间（Unix 秒，含小数）
+	Modified float64 `json:"modified"`
+}
+
+// ModTime 返回修改时间
+func (f UserDataFile) ModTime() time.Time {
+	sec := int64(f.Modified)
+	return time.Unix(sec, int64((f.Modified-float64(sec))*1e9))
+}
+
+// WithComfyUser 为所有请求设置 comfy-user 请求头，在多用户模式（--multi-user）下
+// 选择 /userdata 与 /settings 所属的用户。
+func WithComfyUser(user string) Option {
+	return func(c *Client) { c.cli.SetHeader("comfy-user", user) }
+}
+
+// userDataPath 构造 /userdata/{file} 路径，文件名中的 "/" 需要编码为 %2F
+func userDataPath(file string) string {
+	return "/userdata/" + url.PathEscape(file)
+}
+
+// ListUserData 调用 GET /userdata 列出用户目录下 dir（如 "workflows"）中的文件路径。
+// recurse 为 true 时包含子目录中的文件。目录不存在时返回空列表。
+func (c *Client) ListUserData(ctx context.Context, dir string, recurse bool) ([]string, error) {
+	var out []string
+	if err := c.listUserData(ctx, dir, recurse, false, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListUserDataInfo 与 ListUserData 相同，但返回文件大小和修改时间。
+func (c *Client) ListUserDataInfo(ctx context.Context, dir string, recurse bool) ([]UserDataFile, error) {
+	var out []UserDataFile
+	if err := c.listUserData(ctx, dir, recurse, true, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *Client) listUserData(ctx context.Context, dir string, recurse, fullInfo bool, out interface{}) error {
+	r, err := c.cli.R().
+		SetContext(ctx).
+		SetQueryParams(map[string]string{
+			"dir":       dir,
+			"recurse":   strconv.FormatBool(recurse),
+			"full_info": strconv.FormatBool(fullInfo),
+		}).
+		SetResult(out).
+		Get("/userdata")
+	if err != nil {
+		return err
+	}
+	if r.StatusCode() == http.StatusNotFound {
+		return nil
+	}
+	if !r.IsSuccess() {
+		return fmt.Errorf("/userdata failed: %s", r.String())
+	}
+	return nil
+}
+
+// GetUserData 调用 GET /userdata/{file} 读取用户目录中的文件，file 如 "workflows/portrait.json"。
+func (c *Client) GetUserData(ctx context.Context, file string) ([]byte, error) {
+	path := userDataPath(file)
+	r, err := c.cli.R().SetContext(ctx).Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("GET %s failed: %s", path, r.String())
+	}
+	return r.Bytes(), nil
+}
+
+// SaveUserData 调用 POST /userdata/{file} 写入文件，缺失的目录会自动创建。
+// overwrite 为 false 且文件已存在时返回 ErrUserDataExists。
+func (c *Client) SaveUserData(ctx context.Context, file string, data []byte, overwrite bool) error {
+	path := userDataPath(file)
+	r, err := c.cli.R().
+		SetContext(ctx).
+		SetQueryParam("overwrite", strconv.FormatBool(overwrite)).
+		SetHeader("Content-Type", "application/octet-stream").
+		SetBody(bytes.NewReader(data)).
+		Post(path)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode() == http.StatusConflict {
+		return fmt.Errorf("%w: %s", ErrUserDataExists, file)
+	}
+	if !r.IsSuccess() {
+		return fmt.Errorf("POST %s failed: %s", path, r.String())
+	}
+	return nil
+}
+
+// MoveUserData 调用 POST /userdata/{src}/move/{dest} 移动或重命名文件。
+// overwrite 为 false 且目标已存在时返回 ErrUserDataExists。
+func (c *Client) MoveUserData(ctx context.Context, src, dest string, overwrite bool) error {
+	path := userDataPath(src) + "/move/" + url.PathEscape(dest)
+	r, err := c.cli.R().
+		SetContext(ctx).
+		SetQueryParam("overwrite", strconv.FormatBool(overwrite)).
+		Post(path)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode() == http.StatusConflict {
+		return fmt.Errorf("%w: %s", ErrUserDataExists, dest)
+	}
+	if !r.IsSuccess() {
+		return fmt.Errorf("POST %s failed: %s", path, r.String())
+	}
+	return nil
+}
+
+// DeleteUserData 调用 DELETE /userdata/{file} 删除文件。
+func (c *Client) DeleteUserData(ctx context.Context, file string) error {
+	path := userDataPath(file)
+	r, err := c.cli.R().SetContext(ctx).Delete(path)
+	if err != nil {
+		return err
+	}
+	if !r.IsSuccess() {
+		return fmt.Errorf("DELETE %s failed: %s", path, r.String())
+	}
+	return nil
+}
+
+// GetSettings 调用 GET /settings 返回当前用户的全部设置。
+func (c *Client) GetSettings(ctx context.Context) (JSON, error) {
+	var out JSON
+	r, err := c.cli.R().SetContext(ctx).SetResult(&out).Get("/settings")
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("/settings failed: %s", r.String())
+	}
+	return out, nil
+}
+
+// GetSetting 调用 GET /settings/{id} 返回单个设置的值，未设置时为 nil。
+func (c *Client) GetSetting(ctx context.Context, id string) (interface{}, error) {
+	var out interface{}
+	path := "/settings/" + url.PathEscape(id)
+	r, err := c.cli.R().SetContext(ctx).SetResult(&out).Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if !r.IsSuccess() {
+		return nil, fmt.Errorf("GET %s failed: %s", path, r.String())
+	}
+	return out, nil
+}
+
+// SaveSettings 调用 POST /settings 将 settings 合并到当前用户的设置中。
+func (c *Client) SaveSettings(ctx context.Context, settings JSON) error {
+	r, err := c.cli.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(settings).
+		Post("/settings")
+	if err != nil {
+		return err
+	}
+	if !r.IsSuccess() {
+		return fmt.Errorf("/settings failed: %s", r.String())
+	}
+	return nil
+}
+
+// SaveSetting 调用 POST /settings/{id} 设置单个值。
+func (c *Client) SaveSetting(ctx context.Context, id string, value interface{}) error {
+	// 先编码为 JSON，避免字符串值被当作原始请求体发送
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	path := "/settings/" + url.PathEscape(id)
+	r, err := c.cli.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(path)
+	if err != nil {
+		return err
+	}
+	if !r.IsSuccess() {
+		return fmt.Errorf("POST %s failed: %s", path, r.String())
+	}
+	return nil
+}
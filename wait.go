@@ -0,0 +1,169 @@
+package comfyui2go
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// WaitOption 配置 Wait
+type WaitOption func(*waitOptions)
+
+type waitOptions struct {
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
+	pollingOnly     bool
+}
+
+// WithPollInterval 设置轮询的初始间隔（默认 500 毫秒），任务未结束时逐步放慢到 WithMaxPollInterval。
+func WithPollInterval(d time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		if d > 0 {
+			o.pollInterval = d
+		}
+	}
+}
+
+// WithMaxPollInterval 设置轮询间隔的上限（默认 5 秒）；WebSocket 已连接时轮询只作兜底，按此间隔进行。
+func WithMaxPollInterval(d time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		if d > 0 {
+			o.maxPollInterval = d
+		}
+	}
+}
+
+// WithPollingOnly 只使用轮询等待，不建立 WebSocket 连接。
+func WithPollingOnly() WaitOption {
+	return func(o *waitOptions) { o.pollingOnly = true }
+}
+
+// waitFastRetries 收到结束事件后历史记录可能尚未写入，以 waitFastRetryDelay 间隔快速重试的次数
+const (
+	waitFastRetries    = 10
+	waitFastRetryDelay = 50 * time.Millisecond
+)
+
+// Wait 等待任务结束并返回历史记录，是 WaitForCompletion 与 WaitForCompletionWithWS 的统一入口。
+//
+// 启用 WebSocket 时以执行事件判断结束并立即查询历史记录，轮询只作兜底；WebSocket 未启用、连接失败或中途断开时
+// 退回轮询，间隔从 WithPollInterval 逐步放慢到 WithMaxPollInterval，并在断开后尝试重连。
+// 开始等待时先查询一次历史记录，因此调用前已结束的任务会立即返回。
+//
+// 任务执行失败或被中断时同时返回结果（可能含部分输出）和 *ExecutionError。
+// 查询历史记录的临时错误会被重试，ctx 结束时一并返回最后一次错误。
+func (c *Client) Wait(ctx context.Context, promptID string, opts ...WaitOption) (*WaitResult, error) {
+	o := waitOptions{pollInterval: 500 * time.Millisecond, maxPollInterval: 5 * time.Second}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.maxPollInterval < o.pollInterval {
+		o.maxPollInterval = o.pollInterval
+	}
+
+	finished := make(chan struct{}, 1)
+	var (
+		mu        sync.Mutex
+		wsFailure *ExecutionError
+	)
+	useWS := c.wsEnabled && !o.pollingOnly
+	if useWS {
+		remove := c.addWSListener(func(msg WSMessage) {
+			if id, _ := msg.Data["prompt_id"].(string); id != promptID {
+				return
+			}
+			switch msg.Type {
+			case "executing":
+				if node, _ := msg.Data["node"].(string); node != "" {
+					return
+				}
+			case "execution_success":
+			case "execution_error", "execution_interrupted":
+				mu.Lock()
+				wsFailure = executionErrorFrom(msg.Type, msg.Data)
+				mu.Unlock()
+			default:
+				return
+			}
+			select {
+			case finished <- struct{}{}:
+			default:
+			}
+		})
+		defer remove()
+		// 连接失败时退回轮询
+		_ = c.ensureWebSocketConnected(ctx)
+	}
+
+	interval := o.pollInterval
+	connected := useWS && c.IsWebSocketConnected()
+	// health 定期检查 WebSocket 连接状态（仅本地状态，不产生请求），断开后立即切换为轮询
+	var health <-chan time.Time
+	if useWS {
+		ticker := time.NewTicker(o.pollInterval)
+		defer ticker.Stop()
+		health = ticker.C
+	}
+	fastRetries := 0
+	var lastErr error
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return nil, errors.Join(ctx.Err(), lastErr)
+			}
+			return nil, ctx.Err()
+		case <-finished:
+			fastRetries = waitFastRetries
+			resetTimer(timer, 0)
+		case <-health:
+			now := c.IsWebSocketConnected()
+			if connected && !now {
+				interval = o.pollInterval
+				resetTimer(timer, 0)
+			}
+			connected = now
+		case <-timer.C:
+			h, err := c.GetHistory(ctx, promptID)
+			lastErr = err
+			if err == nil {
+				if item, ok := h[promptID]; ok && item.Finished() {
+					c.observeHistory(promptID, item)
+					result := &WaitResult{PromptID: promptID, Item: item}
+					if failure := historyFailure(promptID, item); failure != nil {
+						return result, failure
+					}
+					return result, nil
+				}
+			}
+			if fastRetries > 0 {
+				fastRetries--
+				resetTimer(timer, waitFastRetryDelay)
+				continue
+			}
+			mu.Lock()
+			failure := wsFailure
+			mu.Unlock()
+			if failure != nil {
+				// 已收到失败事件但历史记录迟迟没有写入
+				return nil, failure
+			}
+
+			if useWS && !connected {
+				_ = c.ensureWebSocketConnected(ctx)
+				connected = c.IsWebSocketConnected()
+			}
+			if connected {
+				resetTimer(timer, o.maxPollInterval)
+				continue
+			}
+			resetTimer(timer, interval)
+			if interval = interval * 3 / 2; interval > o.maxPollInterval {
+				interval = o.maxPollInterval
+			}
+		}
+	}
+}
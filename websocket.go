@@ -2,9 +2,10 @@ package comfyui2go
 
 import (
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"net/url"
 	"strings"
 	"sync"
@@ -20,12 +21,18 @@ type WSClient struct {
 	clientID string
 	username string
 	password string
+	auth     Authenticator
+	hc       *http.Client
+	logger   *slog.Logger
+	tracer   Tracer
+	caps     *ServerCapabilities
 
 	// 回调函数
 	onProgress  ProgressCallback
 	onStatus    StatusCallback
 	onExecution ExecutionCallback
 	onError     ErrorCallback
+	onMessage   func(WSMessage)
 
 	// 内部状态
 	running bool
@@ -36,32 +43,53 @@ type WSClient struct {
 
 // WSConfig WebSocket客户端配置
 type WSConfig struct {
-	BaseURL     string            // ComfyUI服务器地址 (如: "http://localhost:8188")
-	ClientID    string            // 客户端ID
-	Username    string            // 用户名（用于基本认证）
-	Password    string            // 密码（用于基本认证）
-	OnProgress  ProgressCallback  // 进度回调
-	OnStatus    StatusCallback    // 状态回调
-	OnExecution ExecutionCallback // 执行状态回调
-	OnError     ErrorCallback     // 错误回调
+	BaseURL      string              // ComfyUI服务器地址 (如: "http://localhost:8188")
+	ClientID     string              // 客户端ID
+	Username     string              // 用户名（用于基本认证）
+	Password     string              // 密码（用于基本认证）
+	Auth         Authenticator       // 认证方式，设置后优先于 Username/Password
+	HTTPClient   *http.Client        // 握手使用的 HTTP 客户端（TLS、代理），为空时使用 http.DefaultClient
+	Logger       *slog.Logger        // 结构化日志，为空时不输出
+	Tracer       Tracer              // 追踪，为握手创建 span 并注入 traceparent，为空时不追踪
+	Capabilities *ServerCapabilities // 服务器能力，决定进度消息的解析方式，为空时按旧版本服务器处理
+	OnProgress   ProgressCallback    // 进度回调
+	OnStatus     StatusCallback      // 状态回调
+	OnExecution  ExecutionCallback   // 执行状态回调
+	OnError      ErrorCallback       // 错误回调
+	OnMessage    func(WSMessage)     // 原始消息回调，在类型化回调之前调用
 }
 
 // NewWSClient 创建新的WebSocket客户端
 func NewWSClient(config WSConfig) *WSClient {
+	logger := config.Logger
+	if logger == nil {
+		logger = discardLogger
+	}
+	tracer := config.Tracer
+	if tracer == nil {
+		tracer = noopTracer{}
+	}
 	return &WSClient{
+		logger:      logger,
+		tracer:      tracer,
+		caps:        config.Capabilities,
 		baseURL:     config.BaseURL,
 		clientID:    config.ClientID,
 		username:    config.Username,
 		password:    config.Password,
+		auth:        config.Auth,
+		hc:          config.HTTPClient,
 		onProgress:  config.OnProgress,
 		onStatus:    config.OnStatus,
 		onExecution: config.OnExecution,
 		onError:     config.OnError,
+		onMessage:   config.OnMessage,
 	}
 }
 
-// Connect 连接到ComfyUI WebSocket服务
-func (ws *WSClient) Connect(ctx context.Context) error {
+// Connect 连接到ComfyUI WebSocket服务。
+// ctx 只约束握手；连接建立后一直保持到 Close 或服务器断开，不随 ctx 结束。
+func (ws *WSClient) Connect(ctx context.Context) (err error) {
 	ws.mu.Lock()
 	defer ws.mu.Unlock()
 
@@ -75,25 +103,38 @@ func (ws *WSClient) Connect(ctx context.Context) error {
 		return fmt.Errorf("构建WebSocket URL失败: %v", err)
 	}
 
+	ctx, span := ws.tracer.Start(ctx, "comfyui.websocket.connect", Attr("url.full", wsLogURL(wsURL)))
+	defer func() { span.End(err) }()
+
 	// 准备连接选项
-	opts := &websocket.DialOptions{}
+	opts := &websocket.DialOptions{HTTPClient: ws.hc, HTTPHeader: http.Header{}}
+	injectTraceParent(span, opts.HTTPHeader)
 
-	// 如果有认证信息，添加Basic Auth头
-	if ws.username != "" && ws.password != "" {
-		auth := base64.StdEncoding.EncodeToString([]byte(ws.username + ":" + ws.password))
-		opts.HTTPHeader = map[string][]string{
-			"Authorization": {"Basic " + auth},
+	// 握手请求与 HTTP 请求使用相同的认证方式
+	auth := ws.auth
+	if auth == nil && ws.username != "" && ws.password != "" {
+		auth = BasicAuth(ws.username, ws.password)
+	}
+	if auth != nil {
+		if err := auth.Apply(ctx, opts.HTTPHeader); err != nil {
+			return fmt.Errorf("WebSocket认证失败: %v", err)
 		}
 	}
 
 	// 连接WebSocket
-	conn, _, err := websocket.Dial(ctx, wsURL, opts)
+	conn, resp, err := websocket.Dial(ctx, wsURL, opts)
 	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized && auth != nil {
+			invalidateAuth(auth)
+		}
+		ws.logger.Warn("comfyui websocket connect failed", "url", wsLogURL(wsURL), "error", err)
 		return fmt.Errorf("连接WebSocket失败: %v", err)
 	}
+	ws.logger.Info("comfyui websocket connected", "url", wsLogURL(wsURL))
 
 	ws.conn = conn
-	ws.ctx, ws.cancel = context.WithCancel(ctx)
+	// 连接由多个调用方共享，不能随发起连接的调用方的 ctx 一起结束
+	ws.ctx, ws.cancel = context.WithCancel(context.WithoutCancel(ctx))
 	ws.running = true
 
 	// 启动消息处理循环
@@ -131,37 +172,36 @@ func (ws *WSClient) IsConnected() bool {
 	return ws.running && ws.conn != nil
 }
 
-// buildWebSocketURL 构建WebSocket连接URL
+// buildWebSocketURL 构建WebSocket连接URL，保留基础URL中的路径前缀和查询参数
 func (ws *WSClient) buildWebSocketURL() (string, error) {
-	// 解析基础URL
-	baseURL := strings.TrimSuffix(ws.baseURL, "/")
-
-	// 将HTTP(S)协议转换为WS(S)
-	if strings.HasPrefix(baseURL, "http://") {
-		baseURL = strings.Replace(baseURL, "http://", "ws://", 1)
-	} else if strings.HasPrefix(baseURL, "https://") {
-		baseURL = strings.Replace(baseURL, "https://", "wss://", 1)
-	} else if !strings.HasPrefix(baseURL, "ws://") && !strings.HasPrefix(baseURL, "wss://") {
+	baseURL := ws.baseURL
+	if !strings.Contains(baseURL, "://") {
 		// 默认使用ws://
 		baseURL = "ws://" + baseURL
 	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
 
-	// 构建完整的WebSocket URL
-	wsURL := baseURL + "/ws"
+	// 将HTTP(S)协议转换为WS(S)
+	switch u.Scheme {
+	case "http":
+		u.Scheme = "ws"
+	case "https":
+		u.Scheme = "wss"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ws"
+	u.RawPath = ""
 
 	// 添加clientID参数
 	if ws.clientID != "" {
-		u, err := url.Parse(wsURL)
-		if err != nil {
-			return "", err
-		}
 		q := u.Query()
 		q.Set("clientId", ws.clientID)
 		u.RawQuery = q.Encode()
-		wsURL = u.String()
 	}
 
-	return wsURL, nil
+	return u.String(), nil
 }
 
 // messageLoop 消息处理循环
@@ -178,14 +218,23 @@ func (ws *WSClient) messageLoop() {
 			return
 		default:
 			// 读取消息
-			_, messageData, err := ws.conn.Read(ws.ctx)
+			typ, messageData, err := ws.conn.Read(ws.ctx)
 			if err != nil {
+				if ws.ctx.Err() == nil {
+					ws.logger.Warn("comfyui websocket disconnected", "client_id", ws.clientID, "error", err)
+				}
 				if ws.onError != nil {
 					ws.onError("", fmt.Errorf("读取WebSocket消息失败: %v", err))
 				}
 				return
 			}
 
+			// 二进制消息为预览图，不是JSON
+			if typ == websocket.MessageBinary {
+				ws.logger.Debug("comfyui websocket binary message skipped", "size", len(messageData))
+				continue
+			}
+
 			// 处理消息
 			ws.handleMessage(messageData)
 		}
@@ -196,12 +245,17 @@ func (ws *WSClient) messageLoop() {
 func (ws *WSClient) handleMessage(data []byte) {
 	var msg WSMessage
 	if err := json.Unmarshal(data, &msg); err != nil {
+		ws.logger.Warn("comfyui websocket message dropped", "size", len(data), "error", err)
 		if ws.onError != nil {
 			ws.onError("", fmt.Errorf("解析WebSocket消息失败: %v", err))
 		}
 		return
 	}
 
+	if ws.onMessage != nil {
+		ws.onMessage(msg)
+	}
+
 	switch msg.Type {
 	case "status":
 		ws.handleStatusMessage(msg.Data)
@@ -209,8 +263,8 @@ func (ws *WSClient) handleMessage(data []byte) {
 		ws.handleExecutionStartMessage(msg.Data)
 	case "executing":
 		ws.handleExecutingMessage(msg.Data)
-	case "progress":
-		ws.handleProgressMessage(msg.Data)
+	case "progress", "progress_state":
+		ws.handleProgressMessage(msg)
 	case "execution_error":
 		ws.handleExecutionErrorMessage(msg.Data)
 	case "execution_interrupted":
@@ -263,17 +317,14 @@ func (ws *WSClient) handleExecutingMessage(data JSON) {
 	}
 }
 
-// handleProgressMessage 处理进度消息
-func (ws *WSClient) handleProgressMessage(data JSON) {
+// handleProgressMessage 处理进度消息，按服务器能力选择 progress 或 progress_state
+func (ws *WSClient) handleProgressMessage(msg WSMessage) {
 	if ws.onProgress == nil {
 		return
 	}
 
-	var progMsg WSProgressMessage
-	if dataBytes, err := json.Marshal(data); err == nil {
-		if err := json.Unmarshal(dataBytes, &progMsg); err == nil {
-			ws.onProgress("", progMsg) // 进度消息通常不包含prompt_id
-		}
+	for _, p := range progressUpdates(ws.caps, msg) {
+		ws.onProgress(p.PromptID, p) // 旧版本服务器的进度消息不包含prompt_id
 	}
 }
 
@@ -304,99 +355,34 @@ func (ws *WSClient) handleExecutionInterruptedMessage(data JSON) {
 	}
 }
 
-// WaitForCompletionWithWS 使用WebSocket等待任务完成（复用Client的WebSocket连接）
+// WaitForCompletionWithWS 使用WebSocket等待任务完成（复用Client的WebSocket连接）。
+// 未启用 WebSocket 时返回错误；连接中途断开时退回轮询，详见 Wait。
 func (c *Client) WaitForCompletionWithWS(ctx context.Context, promptID string, timeout time.Duration) (*WaitResult, error) {
 	if timeout <= 0 {
 		timeout = 5 * time.Minute
 	}
 
 	// 获取共享的WebSocket客户端
-	wsClient, err := c.GetWebSocketClient(ctx)
-	if err != nil {
+	if _, err := c.GetWebSocketClient(ctx); err != nil {
 		return nil, fmt.Errorf("获取WebSocket连接失败: %v", err)
 	}
 
-	return c.waitForCompletionWithExistingWS(ctx, promptID, timeout, wsClient)
-}
-
-// waitForCompletionWithExistingWS 使用已有的WebSocket连接等待完成
-func (c *Client) waitForCompletionWithExistingWS(ctx context.Context, promptID string, timeout time.Duration, wsClient *WSClient) (*WaitResult, error) {
-	resultChan := make(chan *WaitResult, 1)
-	errorChan := make(chan error, 1)
-	completed := false
-	var mu sync.Mutex
-
-	// 临时设置回调函数（注意：这会覆盖之前的回调）
-	originalOnExecution := wsClient.onExecution
-	originalOnError := wsClient.onError
-
-	// 设置临时回调
-	wsClient.onExecution = func(msgPromptID string, nodeID *string) {
-		// 先调用原始回调
-		if originalOnExecution != nil {
-			originalOnExecution(msgPromptID, nodeID)
-		}
-
-		// 处理当前任务的完成
-		if msgPromptID == promptID && nodeID == nil {
-			mu.Lock()
-			if !completed {
-				completed = true
-				// 获取最终结果
-				go func() {
-					// 稍等一下确保历史记录已更新
-					time.Sleep(500 * time.Millisecond)
-					history, err := c.GetHistory(ctx, promptID)
-					if err != nil {
-						errorChan <- err
-						return
-					}
-					if item, ok := history[promptID]; ok {
-						resultChan <- &WaitResult{PromptID: promptID, Item: item}
-					} else {
-						errorChan <- fmt.Errorf("历史记录中未找到 prompt_id: %s", promptID)
-					}
-				}()
-			}
-			mu.Unlock()
-		}
-	}
-
-	wsClient.onError = func(msgPromptID string, err error) {
-		// 先调用原始回调
-		if originalOnError != nil {
-			originalOnError(msgPromptID, err)
-		}
-
-		// 处理当前任务的错误
-		if msgPromptID == promptID {
-			mu.Lock()
-			if !completed {
-				completed = true
-				errorChan <- err
-			}
-			mu.Unlock()
-		}
-	}
-
-	// 在函数结束时恢复原始回调
-	defer func() {
-		wsClient.onExecution = originalOnExecution
-		wsClient.onError = originalOnError
-	}()
-
-	// 等待结果
 	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-
-	select {
-	case result := <-resultChan:
-		return result, nil
-	case err := <-errorChan:
-		return nil, err
-	case <-timeoutCtx.Done():
+	result, err := c.Wait(timeoutCtx, promptID)
+	if err != nil && ctx.Err() == nil && timeoutCtx.Err() != nil {
 		return nil, fmt.Errorf("等待任务完成超时")
 	}
+	return result, err
+}
+
+// useAPIPrefix 判断是否使用 /api 命名空间：显式配置优先，否则看探测到的服务器是否提供 /api 路由
+func (c *Client) useAPIPrefix() bool {
+	if c.apiPrefixSet {
+		return c.apiPrefix
+	}
+	caps := c.cachedCapabilities()
+	return caps != nil && caps.APIPrefix
 }
 
 // getBaseURL 获取基础URL
@@ -407,12 +393,15 @@ func (c *Client) getBaseURL() string {
 	return "http://localhost:8188" // 默认值
 }
 
-// getUsername 获取用户名
-func (c *Client) getUsername() string {
-	return c.username
+// rootURL 返回基础URL加上路径前缀，不含 /api 命名空间
+func (c *Client) rootURL() string {
+	return strings.TrimSuffix(c.getBaseURL(), "/") + c.pathPrefix
 }
 
-// getPassword 获取密码
-func (c *Client) getPassword() string {
-	return c.password
+// apiURL 返回 ComfyUI 路由的基础地址，使用 /api 命名空间时以 /api 结尾
+func (c *Client) apiURL() string {
+	if c.useAPIPrefix() {
+		return c.rootURL() + "/api"
+	}
+	return c.rootURL()
 }